@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/backup"
+	"github.com/alexraskin/standwithiran/internal/config"
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/database/memory"
+	"github.com/alexraskin/standwithiran/internal/database/sqlite"
+	"github.com/alexraskin/standwithiran/internal/linkcheck"
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/session"
+	"github.com/alexraskin/standwithiran/internal/worker"
+	"github.com/alexraskin/standwithiran/server"
+)
+
+// openDatabase picks the storage backend from the DATABASE_URL scheme.
+func openDatabase(ctx context.Context, dbURL string) (database.Database, error) {
+	switch {
+	case strings.HasPrefix(dbURL, "memory://"):
+		slog.Warn("Using in-memory database, content will be lost on restart")
+		return memory.New(), nil
+	case strings.HasPrefix(dbURL, "sqlite://"):
+		return sqlite.New(ctx, strings.TrimPrefix(dbURL, "sqlite://"))
+	default:
+		return database.NewDatabase(ctx, dbURL)
+	}
+}
+
+func connect(cfg config.Config) (database.Database, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := openDatabase(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	return db, nil
+}
+
+// loginFailureRetention is how long failed sign-ins stay on the review page.
+const loginFailureRetention = 90 * 24 * time.Hour
+
+func runServe(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	tmpl, err := template.New("").ParseFS(templatesFiles, "templates/*.html")
+	if err != nil {
+		return fmt.Errorf("failed to parse templates: %w", err)
+	}
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if cfg.MigrateOnStartup {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if err := db.Migrate(ctx); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
+	var sessions session.Store
+	switch cfg.SessionStore {
+	case "database":
+		sessions = session.NewDBStore(db)
+	case "memory":
+		sessions = session.NewMemoryStore()
+	default:
+		return fmt.Errorf("unknown SESSION_STORE %q, expected database or memory", cfg.SessionStore)
+	}
+
+	srv := server.NewServer(version, cfg.Port, http.FS(staticFiles), tmpl.ExecuteTemplate, db)
+	srv.SetSessionStore(sessions)
+	srv.SetAnalyticsRetention(cfg.AnalyticsRetentionDays)
+	srv.SetLinkCheckPolicy(cfg.LinkCheckFailures, cfg.HideBrokenLinks)
+	srv.SetSecurityHeaders(cfg.HSTSMaxAge, cfg.CSPReportOnly)
+	srv.SetMetricsToken(cfg.MetricsToken)
+	if err := srv.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	srv.AddReadinessCheck("templates", func(ctx context.Context) error {
+		return checkTemplates(tmpl)
+	})
+
+	workers := worker.NewGroup()
+	workers.Add("analytics-flush", time.Minute, func(ctx context.Context) error {
+		return srv.Analytics().Flush(ctx, db)
+	})
+	workers.Add("analytics-retention", time.Hour, func(ctx context.Context) error {
+		cutoff := time.Now().UTC().AddDate(0, 0, -cfg.AnalyticsRetentionDays)
+		return db.PruneAnalytics(ctx, cutoff.Format(time.DateOnly))
+	})
+	workers.Add("session-sweep", 15*time.Minute, func(ctx context.Context) error {
+		n, err := sessions.DeleteExpired(ctx, time.Now())
+		if n > 0 {
+			slog.Info("Removed expired sessions", "count", n)
+		}
+		return err
+	})
+	workers.Add("login-failure-retention", time.Hour, func(ctx context.Context) error {
+		_, err := db.PruneLoginFailures(ctx, time.Now().Add(-loginFailureRetention))
+		return err
+	})
+	if cfg.LinkCheckInterval > 0 {
+		monitor := linkcheck.NewMonitor(db, linkcheck.NewChecker(15*time.Second), cfg.LinkCheckFailures)
+		// Deploys restart the interval, so check once on startup too
+		workers.AddImmediate("link-check", cfg.LinkCheckInterval, monitor.Run)
+	}
+	workers.Start(context.Background())
+	srv.AddReadinessCheck("workers", workers.Check)
+	// Deferred after db.Close, so it runs first: the workers and the last
+	// analytics flush are done with the pool before it closes.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := workers.Shutdown(ctx); err != nil {
+			slog.Error("Failed to stop background workers", "error", err)
+		}
+		if err := srv.Analytics().Flush(ctx, db); err != nil {
+			slog.Error("Failed to flush analytics", "error", err)
+		}
+	}()
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start() }()
+
+	slog.Info("Started server", slog.String("listen_addr", ":"+cfg.Port))
+	si := make(chan os.Signal, 1)
+	signal.Notify(si, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		return fmt.Errorf("server failed: %w", err)
+	case sig := <-si:
+		slog.Info("Shutting down server", "signal", sig.String())
+	}
+	// A second signal kills the process instead of waiting for the drain
+	signal.Stop(si)
+
+	srv.Drain()
+	if cfg.ShutdownDelay > 0 {
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down server cleanly", "error", err)
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// checkTemplates confirms every embedded template was parsed, so a page
+// can't fail to render because its template went missing.
+func checkTemplates(tmpl *template.Template) error {
+	files, err := fs.Glob(templatesFiles, "templates/*.html")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if tmpl.Lookup(path.Base(file)) == nil {
+			return fmt.Errorf("template %s is not loaded", path.Base(file))
+		}
+	}
+	return nil
+}
+
+func runMigrate(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := db.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+	slog.Info("Migrations complete")
+	return nil
+}
+
+func runSetPassword(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("set-password", flag.ExitOnError)
+	username := fs.String("user", "admin", "account to set the password for")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: standwithiran set-password [-user NAME] < password.txt")
+		fmt.Fprintln(fs.Output(), "Reads the new password from the first line of stdin.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.SetUserPassword(context.Background(), *username, password); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	n, err := db.DeleteUserSessions(context.Background(), *username, "")
+	if err != nil {
+		return fmt.Errorf("failed to sign out sessions: %w", err)
+	}
+	slog.Info("Password updated", "user", *username, "sessions_revoked", n)
+	return nil
+}
+
+func runAddUser(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("add-user", flag.ExitOnError)
+	username := fs.String("user", "", "username to create")
+	role := fs.String("role", models.RoleEditor, "role: owner, editor or viewer")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: standwithiran add-user -user NAME [-role ROLE] < password.txt")
+		fmt.Fprintln(fs.Output(), "Reads the new account's password from the first line of stdin.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	user := models.User{Username: strings.ToLower(*username), Role: *role}
+	if !models.ValidUsername(user.Username) {
+		return errors.New("username must be 2-32 lowercase letters, digits, dots, dashes or underscores")
+	}
+	if !slices.Contains(models.Roles, user.Role) {
+		return fmt.Errorf("unknown role %q", user.Role)
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.AddUser(context.Background(), user, password); err != nil {
+		return fmt.Errorf("failed to add user: %w", err)
+	}
+	slog.Info("User added", "user", user.Username, "role", user.Role)
+	return nil
+}
+
+func runResetTwoFactor(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("reset-2fa", flag.ExitOnError)
+	username := fs.String("user", "", "account to turn two-factor authentication off for")
+	_ = fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("-user is required")
+	}
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.DisableTOTP(context.Background(), *username); err != nil {
+		return fmt.Errorf("failed to reset two-factor authentication: %w", err)
+	}
+	n, err := db.DeleteUserSessions(context.Background(), *username, "")
+	if err != nil {
+		return fmt.Errorf("failed to sign out sessions: %w", err)
+	}
+	slog.Info("Two-factor authentication turned off", "user", *username, "sessions_revoked", n)
+	return nil
+}
+
+// readPassword reads a password from the first line of stdin.
+func readPassword() (string, error) {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) < server.MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", server.MinPasswordLength)
+	}
+	return password, nil
+}
+
+func runExport(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "-", "file to write the export to (- for stdout)")
+	_ = fs.Parse(args)
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	doc, err := backup.Export(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return backup.Write(os.Stdout, doc)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := backup.Write(f, doc); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runImport(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	input := fs.String("f", "-", "export file to import (- for stdin)")
+	dryRun := fs.Bool("dry-run", false, "print what would change without applying it")
+	_ = fs.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	doc, err := backup.Read(r)
+	if err != nil {
+		return err
+	}
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *dryRun {
+		current, err := backup.Load(context.Background(), db)
+		if err != nil {
+			return err
+		}
+		printDiff(os.Stdout, backup.Compare(current, doc.Content()))
+		return nil
+	}
+
+	if err := backup.Import(context.Background(), db, doc); err != nil {
+		return err
+	}
+	slog.Info("Import complete", slog.Int("links", len(doc.Links)))
+	return nil
+}
+
+func printDiff(w io.Writer, diff models.ContentDiff) {
+	if diff.Empty() {
+		_, _ = fmt.Fprintln(w, "No changes")
+		return
+	}
+	for _, c := range diff.Profile {
+		_, _ = fmt.Fprintf(w, "~ profile %s: %q -> %q\n", c.Field, c.From, c.To)
+	}
+	for _, c := range diff.Banner {
+		_, _ = fmt.Fprintf(w, "~ banner %s: %q -> %q\n", c.Field, c.From, c.To)
+	}
+	for _, l := range diff.Added {
+		_, _ = fmt.Fprintf(w, "+ link %s %q (%s)\n", l.ID, l.Title, l.URL)
+	}
+	for _, l := range diff.Removed {
+		_, _ = fmt.Fprintf(w, "- link %s %q (%s)\n", l.ID, l.Title, l.URL)
+	}
+	for _, l := range diff.Updated {
+		for _, c := range l.Changes {
+			_, _ = fmt.Fprintf(w, "~ link %s %s: %q -> %q\n", l.ID, c.Field, c.From, c.To)
+		}
+	}
+	if diff.Reordered {
+		_, _ = fmt.Fprintln(w, "~ link order changed")
+	}
+	for _, b := range diff.BannersAdded {
+		_, _ = fmt.Fprintf(w, "+ scheduled banner %s %q\n", b.ID, b.Text)
+	}
+	for _, b := range diff.BannersRemoved {
+		_, _ = fmt.Fprintf(w, "- scheduled banner %s %q\n", b.ID, b.Text)
+	}
+	for _, b := range diff.BannersUpdated {
+		for _, c := range b.Changes {
+			_, _ = fmt.Fprintf(w, "~ scheduled banner %s %s: %q -> %q\n", b.ID, c.Field, c.From, c.To)
+		}
+	}
+}
+
+func runCheckLinks(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("check-links", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 15*time.Second, "per-request timeout")
+	_ = fs.Parse(args)
+
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	links, err := db.GetLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load links: %w", err)
+	}
+
+	urls := make([]string, len(links))
+	for i, l := range links {
+		urls[i] = l.URL
+	}
+	results := linkcheck.NewChecker(*timeout).CheckAll(ctx, urls, 8)
+
+	broken := 0
+	for i, res := range results {
+		l := links[i]
+		switch {
+		case res.Skipped:
+			fmt.Printf("SKIP  %s  %s: not a web link\n", l.ID, l.URL)
+		case res.Err != nil:
+			broken++
+			fmt.Printf("FAIL  %s  %s: %v\n", l.ID, l.URL, res.Err)
+		case !res.OK():
+			broken++
+			fmt.Printf("FAIL  %s  %s: HTTP %d\n", l.ID, l.URL, res.StatusCode)
+		case res.FinalURL != l.URL:
+			fmt.Printf("OK    %s  %s -> %s\n", l.ID, l.URL, res.FinalURL)
+		default:
+			fmt.Printf("OK    %s  %s\n", l.ID, l.URL)
+		}
+	}
+
+	if broken > 0 {
+		return fmt.Errorf("%d of %d links failed", broken, len(links))
+	}
+	return nil
+}
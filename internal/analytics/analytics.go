@@ -0,0 +1,220 @@
+// Package analytics keeps aggregate, privacy-preserving traffic counters:
+// page views and link clicks per day and referring domain. No IP address,
+// user agent or cookie is ever stored.
+package analytics
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+type Store interface {
+	IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error
+}
+
+type bucket struct {
+	day      string
+	kind     string
+	referrer string
+}
+
+// MaxReferrersPerDay caps the referring domains a Recorder counts
+// separately each day. The Referer header is sent by the client, so without
+// a cap every made-up domain would add a row.
+const MaxReferrersPerDay = 200
+
+// OtherReferrer is the referrer recorded once a day's cap is reached. It
+// can't clash with a domain, which never contains parentheses.
+const OtherReferrer = "(other)"
+
+// Recorder buffers counter increments in memory so a traffic spike costs one
+// write per bucket per flush instead of one per request.
+type Recorder struct {
+	mu      sync.Mutex
+	pending map[bucket]int
+	// referrers holds the domains counted separately on day. It is kept
+	// per process, so each replica and restart has its own allowance.
+	day          string
+	referrers    map[string]bool
+	maxReferrers int
+	now          func() time.Time
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		pending:      make(map[bucket]int),
+		referrers:    make(map[string]bool),
+		maxReferrers: MaxReferrersPerDay,
+		now:          time.Now,
+	}
+}
+
+func (r *Recorder) PageView(referrer string) {
+	r.add(models.AnalyticsView, referrer)
+}
+
+func (r *Recorder) Click(referrer string) {
+	r.add(models.AnalyticsClick, referrer)
+}
+
+func (r *Recorder) add(kind, referrer string) {
+	day := r.now().UTC().Format(time.DateOnly)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if day != r.day {
+		r.day = day
+		clear(r.referrers)
+	}
+	// The first domains of the day keep their own counter, later ones are
+	// pooled
+	if referrer != "" && !r.referrers[referrer] {
+		if len(r.referrers) < r.maxReferrers {
+			r.referrers[referrer] = true
+		} else {
+			referrer = OtherReferrer
+		}
+	}
+	r.pending[bucket{day: day, kind: kind, referrer: referrer}]++
+}
+
+// Flush writes the buffered counts to store. On failure the counts are put
+// back so the next flush retries them.
+func (r *Recorder) Flush(ctx context.Context, store Store) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[bucket]int)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	counts := make([]models.AnalyticsCount, 0, len(pending))
+	for b, n := range pending {
+		counts = append(counts, models.AnalyticsCount{Day: b.day, Kind: b.kind, Referrer: b.referrer, Count: n})
+	}
+
+	if err := store.IncrementAnalytics(ctx, counts); err != nil {
+		r.mu.Lock()
+		for b, n := range pending {
+			r.pending[b] += n
+		}
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// ReferrerDomain reduces a Referer header to its host name, dropping "www."
+// and anything that points back at ownHost. Invalid values become "".
+func ReferrerDomain(referer, ownHost string) string {
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return CleanDomain(u.Hostname(), ownHost)
+}
+
+// CleanDomain normalises a bare host name the same way ReferrerDomain does.
+func CleanDomain(host, ownHost string) string {
+	host = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(host, ".")), "www.")
+	if own, _, err := net.SplitHostPort(ownHost); err == nil {
+		ownHost = own
+	}
+	ownHost = strings.TrimPrefix(strings.ToLower(ownHost), "www.")
+
+	if host == "" || host == ownHost || len(host) > 253 {
+		return ""
+	}
+	for _, c := range host {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '.' {
+			return ""
+		}
+	}
+	return host
+}
+
+var botMarkers = []string{"bot", "crawl", "spider", "slurp", "preview", "facebookexternalhit", "curl", "wget", "python-requests", "go-http-client"}
+
+// IsBot reports whether a user agent looks automated. The user agent is only
+// inspected, never stored.
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	ua := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Summarize totals rows per day (newest first, every day in the range
+// present) and per referrer (busiest first).
+func Summarize(rows []models.AnalyticsRow, since time.Time, days int) models.AnalyticsPageData {
+	data := models.AnalyticsPageData{Days: days}
+
+	daily := make(map[string]*models.AnalyticsTotal, days)
+	for i := range days {
+		day := since.AddDate(0, 0, i).Format(time.DateOnly)
+		daily[day] = &models.AnalyticsTotal{Label: day}
+	}
+	referrers := make(map[string]*models.AnalyticsTotal)
+
+	for _, row := range rows {
+		data.Views += row.Views
+		data.Clicks += row.Clicks
+
+		if d, ok := daily[row.Day]; ok {
+			d.Views += row.Views
+			d.Clicks += row.Clicks
+		}
+
+		label := row.Referrer
+		if label == "" {
+			label = "(direct)"
+		}
+		ref, ok := referrers[label]
+		if !ok {
+			ref = &models.AnalyticsTotal{Label: label}
+			referrers[label] = ref
+		}
+		ref.Views += row.Views
+		ref.Clicks += row.Clicks
+	}
+
+	for _, d := range daily {
+		data.Daily = append(data.Daily, *d)
+	}
+	sort.Slice(data.Daily, func(i, j int) bool { return data.Daily[i].Label > data.Daily[j].Label })
+
+	for _, ref := range referrers {
+		data.Referrers = append(data.Referrers, *ref)
+	}
+	sort.Slice(data.Referrers, func(i, j int) bool {
+		a, b := data.Referrers[i], data.Referrers[j]
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		return a.Label < b.Label
+	})
+
+	return data
+}
@@ -0,0 +1,169 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+type fakeStore struct {
+	counts []models.AnalyticsCount
+	err    error
+}
+
+func (f *fakeStore) IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.counts = append(f.counts, counts...)
+	return nil
+}
+
+func TestRecorderCapsReferrers(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder()
+	r.maxReferrers = 2
+	r.now = func() time.Time { return day }
+
+	r.PageView("a.example")
+	r.PageView("b.example")
+	r.PageView("c.example")
+	r.Click("d.example")
+	r.PageView("a.example")
+	r.PageView("")
+
+	// A new day starts a new allowance
+	day = day.AddDate(0, 0, 1)
+	r.PageView("c.example")
+
+	store := &fakeStore{}
+	if err := r.Flush(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]int)
+	for _, c := range store.counts {
+		got[c.Day+"|"+c.Kind+"|"+c.Referrer] = c.Count
+	}
+	want := map[string]int{
+		"2026-03-01|view|a.example": 2,
+		"2026-03-01|view|b.example": 1,
+		"2026-03-01|view|(other)":   1,
+		"2026-03-01|click|(other)":  1,
+		"2026-03-01|view|":          1,
+		"2026-03-02|view|c.example": 1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("%s: expected %d, got %d", k, n, got[k])
+		}
+	}
+}
+
+func TestRecorderFlush(t *testing.T) {
+	r := NewRecorder()
+	r.now = func() time.Time { return time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC) }
+
+	r.PageView("t.co")
+	r.PageView("t.co")
+	r.PageView("")
+	r.Click("t.co")
+
+	store := &fakeStore{err: errors.New("database down")}
+	if err := r.Flush(context.Background(), store); err == nil {
+		t.Fatal("expected flush error")
+	}
+
+	// A failed flush keeps the counts for the next attempt
+	store.err = nil
+	if err := r.Flush(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]int)
+	for _, c := range store.counts {
+		if c.Day != "2026-03-01" {
+			t.Errorf("unexpected day %q", c.Day)
+		}
+		got[c.Kind+"|"+c.Referrer] = c.Count
+	}
+	if len(got) != 3 || got["view|t.co"] != 2 || got["view|"] != 1 || got["click|t.co"] != 1 {
+		t.Errorf("unexpected counts %v", got)
+	}
+
+	// Nothing is left over after a successful flush
+	store.counts = nil
+	_ = r.Flush(context.Background(), store)
+	if len(store.counts) != 0 {
+		t.Errorf("expected empty flush, got %v", store.counts)
+	}
+}
+
+func TestReferrerDomain(t *testing.T) {
+	tests := []struct {
+		referer string
+		want    string
+	}{
+		{"", ""},
+		{"https://t.co/abc123", "t.co"},
+		{"https://www.Instagram.com/p/xyz?utm_source=ig", "instagram.com"},
+		{"http://news.example.org:8080/story", "news.example.org"},
+		{"https://standwithiran.example/admin", ""},
+		{"android-app://com.twitter.android/", ""},
+		{"not a url", ""},
+		{"https://evil.example/<script>", "evil.example"},
+		{"https://xn--mgba3a4f16a.ir/", "xn--mgba3a4f16a.ir"},
+		{"https://ایران.ir/", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ReferrerDomain(tt.referer, "standwithiran.example:443"); got != tt.want {
+			t.Errorf("ReferrerDomain(%q) = %q, want %q", tt.referer, got, tt.want)
+		}
+	}
+}
+
+func TestIsBot(t *testing.T) {
+	bots := []string{"", "Googlebot/2.1", "facebookexternalhit/1.1", "curl/8.0", "Slackbot-LinkExpanding 1.0"}
+	for _, ua := range bots {
+		if !IsBot(ua) {
+			t.Errorf("expected %q to be treated as a bot", ua)
+		}
+	}
+	if IsBot("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148") {
+		t.Error("expected a mobile browser not to be a bot")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows := []models.AnalyticsRow{
+		{Day: "2026-03-01", Referrer: "", Views: 5, Clicks: 1},
+		{Day: "2026-03-01", Referrer: "t.co", Views: 2},
+		{Day: "2026-03-03", Referrer: "t.co", Views: 10, Clicks: 4},
+	}
+
+	data := Summarize(rows, since, 3)
+
+	if data.Views != 17 || data.Clicks != 5 {
+		t.Errorf("unexpected totals %d views, %d clicks", data.Views, data.Clicks)
+	}
+	if len(data.Daily) != 3 {
+		t.Fatalf("expected a row for every day, got %+v", data.Daily)
+	}
+	if data.Daily[0].Label != "2026-03-03" || data.Daily[0].Views != 10 {
+		t.Errorf("expected newest day first, got %+v", data.Daily[0])
+	}
+	if data.Daily[1].Label != "2026-03-02" || data.Daily[1].Views != 0 {
+		t.Errorf("expected empty middle day, got %+v", data.Daily[1])
+	}
+	if len(data.Referrers) != 2 || data.Referrers[0].Label != "t.co" || data.Referrers[1].Label != "(direct)" {
+		t.Errorf("unexpected referrers %+v", data.Referrers)
+	}
+}
@@ -0,0 +1,268 @@
+// Package backup defines the JSON document used to export and restore the
+// site content.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/urlpolicy"
+)
+
+// FormatVersion is bumped whenever the document layout changes in a way
+// older readers cannot handle. Version 2 added link schedules and scheduled
+// banners; version 1 documents are still accepted.
+const FormatVersion = 2
+
+type Document struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Profile    Profile   `json:"profile"`
+	Links      []Link    `json:"links"`
+	Banner     Banner    `json:"banner"`
+	// ScheduledBanners is missing from older exports, in which case the
+	// import leaves the banner queue alone.
+	ScheduledBanners []ScheduledBanner `json:"scheduled_banners"`
+}
+
+type Profile struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Subtitle    string `json:"subtitle"`
+	Description string `json:"description"`
+	Avatar      string `json:"avatar"`
+}
+
+type Link struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Category string `json:"category"`
+	Icon     string `json:"icon"`
+	Featured bool   `json:"featured"`
+	// Omitted when unset so unscheduled exports stay readable by older
+	// versions.
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type Banner struct {
+	Enabled bool   `json:"enabled"`
+	Text    string `json:"text"`
+	Link    string `json:"link"`
+	Type    string `json:"type"`
+}
+
+type ScheduledBanner struct {
+	ID       string     `json:"id"`
+	Text     string     `json:"text"`
+	Link     string     `json:"link"`
+	Type     string     `json:"type"`
+	Priority int        `json:"priority"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// Load reads the current site content from db.
+func Load(ctx context.Context, db database.Database) (models.Content, error) {
+	profile, err := db.GetProfile(ctx)
+	if err != nil {
+		return models.Content{}, fmt.Errorf("failed to load profile: %w", err)
+	}
+	links, err := db.GetLinks(ctx)
+	if err != nil {
+		return models.Content{}, fmt.Errorf("failed to load links: %w", err)
+	}
+	banner, err := db.GetBanner(ctx)
+	if err != nil {
+		return models.Content{}, fmt.Errorf("failed to load banner: %w", err)
+	}
+	scheduled, err := db.GetScheduledBanners(ctx)
+	if err != nil {
+		return models.Content{}, fmt.Errorf("failed to load scheduled banners: %w", err)
+	}
+	return models.Content{Profile: profile, Links: links, Banner: banner, ScheduledBanners: scheduled}, nil
+}
+
+// Export snapshots the current content. Links keep their display order.
+func Export(ctx context.Context, db database.Database) (Document, error) {
+	c, err := Load(ctx, db)
+	if err != nil {
+		return Document{}, err
+	}
+
+	doc := Document{
+		Version:    FormatVersion,
+		ExportedAt: time.Now().UTC(),
+		Profile:    Profile(c.Profile),
+		Links:      make([]Link, 0, len(c.Links)),
+		Banner:     Banner(c.Banner),
+		// Always present, so importing an export without banners clears
+		// the queue.
+		ScheduledBanners: make([]ScheduledBanner, 0, len(c.ScheduledBanners)),
+	}
+	for _, l := range c.Links {
+		doc.Links = append(doc.Links, Link(l))
+	}
+	for _, b := range c.ScheduledBanners {
+		doc.ScheduledBanners = append(doc.ScheduledBanners, ScheduledBanner(b))
+	}
+	return doc, nil
+}
+
+// Import replaces the site content with doc in a single transaction, keeping
+// link IDs so existing links are updated rather than recreated.
+func Import(ctx context.Context, db database.Database, doc Document) error {
+	if err := doc.Validate(); err != nil {
+		return err
+	}
+	return db.ReplaceContent(ctx, doc.Content())
+}
+
+// Content converts doc to the models used by the database. A missing
+// category, icon or banner type gets the same default the admin forms use.
+func (doc Document) Content() models.Content {
+	c := models.Content{
+		Profile: models.Profile(doc.Profile),
+		Links:   make([]models.Link, 0, len(doc.Links)),
+		Banner:  models.Banner(doc.Banner),
+	}
+	if c.Banner.Type == "" {
+		c.Banner.Type = models.DefaultBannerType
+	}
+	for _, l := range doc.Links {
+		link := models.Link(l)
+		if link.Category == "" {
+			link.Category = models.DefaultCategory
+		}
+		if link.Icon == "" {
+			link.Icon = models.DefaultIcon
+		}
+		c.Links = append(c.Links, link)
+	}
+	if doc.ScheduledBanners != nil {
+		c.ScheduledBanners = make([]models.ScheduledBanner, 0, len(doc.ScheduledBanners))
+		for _, b := range doc.ScheduledBanners {
+			c.ScheduledBanners = append(c.ScheduledBanners, models.ScheduledBanner(b))
+		}
+	}
+	return c
+}
+
+// Validate checks that doc can be imported by this version of the site.
+func (doc Document) Validate() error {
+	if err := checkVersion(doc.Version); err != nil {
+		return err
+	}
+
+	if doc.Profile.Avatar != "" {
+		if _, err := urlpolicy.Image.Normalize(doc.Profile.Avatar); err != nil {
+			return fmt.Errorf("profile avatar: %w", err)
+		}
+	}
+	if doc.Banner.Type != "" && !slices.Contains(models.BannerTypes, doc.Banner.Type) {
+		return fmt.Errorf("banner: unknown type %q", doc.Banner.Type)
+	}
+	if doc.Banner.Link != "" {
+		if _, err := urlpolicy.Link.Normalize(doc.Banner.Link); err != nil {
+			return fmt.Errorf("banner link: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool, len(doc.Links))
+	for i, l := range doc.Links {
+		if l.ID == "" || l.Title == "" || l.URL == "" {
+			return fmt.Errorf("link %d: id, title and url are required", i+1)
+		}
+		if _, err := urlpolicy.Link.Normalize(l.URL); err != nil {
+			return fmt.Errorf("link %d: url %q: %w", i+1, l.URL, err)
+		}
+		if l.Category != "" && !slices.Contains(models.Categories, l.Category) {
+			return fmt.Errorf("link %d: unknown category %q", i+1, l.Category)
+		}
+		if l.Icon != "" && !slices.Contains(models.Icons, l.Icon) {
+			return fmt.Errorf("link %d: unknown icon %q", i+1, l.Icon)
+		}
+		if l.PublishAt != nil && l.ExpiresAt != nil && !l.ExpiresAt.After(*l.PublishAt) {
+			return fmt.Errorf("link %d: expires_at must be after publish_at", i+1)
+		}
+		if seen[l.ID] {
+			return fmt.Errorf("link %d: duplicate id %q", i+1, l.ID)
+		}
+		seen[l.ID] = true
+	}
+
+	seen = make(map[string]bool, len(doc.ScheduledBanners))
+	for i, b := range doc.ScheduledBanners {
+		if b.ID == "" || b.Text == "" {
+			return fmt.Errorf("scheduled banner %d: id and text are required", i+1)
+		}
+		if !slices.Contains(models.BannerTypes, b.Type) {
+			return fmt.Errorf("scheduled banner %d: unknown type %q", i+1, b.Type)
+		}
+		if b.Link != "" {
+			if _, err := urlpolicy.Link.Normalize(b.Link); err != nil {
+				return fmt.Errorf("scheduled banner %d: link %q: %w", i+1, b.Link, err)
+			}
+		}
+		if b.StartsAt != nil && b.EndsAt != nil && !b.EndsAt.After(*b.StartsAt) {
+			return fmt.Errorf("scheduled banner %d: ends_at must be after starts_at", i+1)
+		}
+		if seen[b.ID] {
+			return fmt.Errorf("scheduled banner %d: duplicate id %q", i+1, b.ID)
+		}
+		seen[b.ID] = true
+	}
+	return nil
+}
+
+func Write(w io.Writer, doc Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Read decodes and validates an export. The version is checked before the
+// rest of the document, so a newer export is reported as such rather than
+// as having unknown fields.
+func Read(r io.Reader) (Document, error) {
+	var doc Document
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return doc, fmt.Errorf("failed to read export file: %w", err)
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return doc, fmt.Errorf("invalid export file: %w", err)
+	}
+	if err := checkVersion(header.Version); err != nil {
+		return doc, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return doc, fmt.Errorf("invalid export file: %w", err)
+	}
+	return doc, doc.Validate()
+}
+
+func checkVersion(version int) error {
+	switch {
+	case version > FormatVersion:
+		return fmt.Errorf("export version %d is newer than this site supports (up to %d); upgrade before importing it", version, FormatVersion)
+	case version < 1:
+		return fmt.Errorf("unsupported export version %d", version)
+	}
+	return nil
+}
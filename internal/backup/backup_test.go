@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database/memory"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	src := memory.New()
+	_ = src.UpdateProfile(ctx, models.Profile{Name: "Mirror", Title: "Title"})
+	_ = src.AddLink(ctx, models.Link{ID: "a", Title: "A", URL: "https://a.example"})
+	expires := time.Date(2026, 3, 8, 18, 0, 0, 0, time.UTC)
+	_ = src.AddLink(ctx, models.Link{ID: "b", Title: "B", URL: "https://b.example", Featured: true, ExpiresAt: &expires})
+	_ = src.UpdateBanner(ctx, models.Banner{Enabled: true, Text: "Rally", Type: "urgent"})
+	starts := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	_ = src.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "s", Text: "March", Link: "https://march.example", Type: "info", Priority: 1, StartsAt: &starts})
+
+	doc, err := Export(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != FormatVersion {
+		t.Errorf("expected version %d, got %d", FormatVersion, read.Version)
+	}
+
+	dst := memory.New()
+	_ = dst.AddLink(ctx, models.Link{ID: "stale", Title: "Stale", URL: "https://stale.example"})
+	_ = dst.AddLink(ctx, models.Link{ID: "a", Title: "Old A", URL: "https://old.example"})
+	_ = dst.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "gone", Text: "Gone", Type: "info"})
+	if err := Import(ctx, dst, read); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, _ := dst.GetProfile(ctx); p.Name != "Mirror" {
+		t.Errorf("expected profile to be imported, got %+v", p)
+	}
+	if b, _ := dst.GetBanner(ctx); !b.Enabled || b.Text != "Rally" {
+		t.Errorf("expected banner to be imported, got %+v", b)
+	}
+	links, _ := dst.GetLinks(ctx)
+	if len(links) != 2 || links[0].ID != "b" || links[1].ID != "a" || links[1].Title != "A" {
+		t.Errorf("expected links b, a to replace existing links, got %+v", links)
+	}
+	if len(links) == 2 && (links[0].ExpiresAt == nil || !links[0].ExpiresAt.Equal(expires) || links[1].ExpiresAt != nil) {
+		t.Errorf("expected the expiry to survive the round trip, got %+v", links)
+	}
+	if len(links) == 2 && (links[1].Category != models.DefaultCategory || links[1].Icon != models.DefaultIcon) {
+		t.Errorf("expected a link without category or icon to get the defaults, got %+v", links[1])
+	}
+	banners, _ := dst.GetScheduledBanners(ctx)
+	if len(banners) != 1 || banners[0].ID != "s" || banners[0].StartsAt == nil || !banners[0].StartsAt.Equal(starts) {
+		t.Errorf("expected scheduled banners to replace existing ones, got %+v", banners)
+	}
+}
+
+func TestReadRejectsInvalidDocuments(t *testing.T) {
+	tests := map[string]string{
+		"future version": `{"version": 99}`,
+		"missing url":    `{"version": 1, "links": [{"id": "a", "title": "A"}]}`,
+		"duplicate id":   `{"version": 1, "links": [{"id": "a", "title": "A", "url": "https://a.example"}, {"id": "a", "title": "B", "url": "https://b.example"}]}`,
+		"unknown field":  `{"version": 1, "passwords": []}`,
+		"bad schedule":   `{"version": 1, "links": [{"id": "a", "title": "A", "url": "https://a.example", "publish_at": "2026-03-02T00:00:00Z", "expires_at": "2026-03-01T00:00:00Z"}]}`,
+		"not json":       `hello`,
+		"script url":     `{"version": 1, "links": [{"id": "a", "title": "A", "url": "javascript:alert(1)"}]}`,
+		"private url":    `{"version": 1, "links": [{"id": "a", "title": "A", "url": "http://10.0.0.1/"}]}`,
+		"data avatar":    `{"version": 1, "profile": {"avatar": "data:image/svg+xml,<svg onload=alert(1)>"}}`,
+		"local banner":   `{"version": 1, "banner": {"link": "http://localhost/"}}`,
+		"bad category":   `{"version": 1, "links": [{"id": "a", "title": "A", "url": "https://a.example", "category": "secret"}]}`,
+		"bad icon":       `{"version": 1, "links": [{"id": "a", "title": "A", "url": "https://a.example", "icon": "skull"}]}`,
+		"bad banner":     `{"version": 1, "banner": {"type": "blink"}}`,
+		"scheduled link": `{"version": 1, "scheduled_banners": [{"id": "s", "text": "S", "type": "info", "link": "javascript:alert(1)"}]}`,
+		"scheduled type": `{"version": 1, "scheduled_banners": [{"id": "s", "text": "S", "type": "blink"}]}`,
+		"scheduled span": `{"version": 1, "scheduled_banners": [{"id": "s", "text": "S", "type": "info", "starts_at": "2026-03-02T00:00:00Z", "ends_at": "2026-03-01T00:00:00Z"}]}`,
+	}
+	for name, input := range tests {
+		if _, err := Read(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestReadVersions(t *testing.T) {
+	v1 := `{"version": 1, "links": [{"id": "a", "title": "A", "url": "https://a.example"}]}`
+	doc, err := Read(strings.NewReader(v1))
+	if err != nil {
+		t.Fatalf("expected version 1 to be accepted, got %v", err)
+	}
+	if doc.ScheduledBanners != nil {
+		t.Errorf("expected no scheduled banners in a version 1 export, got %+v", doc.ScheduledBanners)
+	}
+
+	// Newer fields must not hide the version error
+	future := `{"version": 3, "something_new": true}`
+	if _, err := Read(strings.NewReader(future)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected a newer-version error, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+// Compare reports what importing incoming over current would change.
+func Compare(current, incoming models.Content) models.ContentDiff {
+	var diff models.ContentDiff
+
+	diff.Profile = compareFields(profileFields(current.Profile), profileFields(incoming.Profile))
+	diff.Banner = compareFields(bannerFields(current.Banner), bannerFields(incoming.Banner))
+
+	existing := make(map[string]models.Link, len(current.Links))
+	for _, l := range current.Links {
+		existing[l.ID] = l
+	}
+	kept := make(map[string]bool, len(incoming.Links))
+	var currentOrder, incomingOrder []string
+	for _, l := range incoming.Links {
+		kept[l.ID] = true
+		old, ok := existing[l.ID]
+		if !ok {
+			diff.Added = append(diff.Added, l)
+			continue
+		}
+		incomingOrder = append(incomingOrder, l.ID)
+		if changes := compareFields(linkFields(old), linkFields(l)); len(changes) > 0 {
+			diff.Updated = append(diff.Updated, models.LinkChange{ID: l.ID, Title: l.Title, Changes: changes})
+		}
+	}
+	for _, l := range current.Links {
+		if !kept[l.ID] {
+			diff.Removed = append(diff.Removed, l)
+			continue
+		}
+		currentOrder = append(currentOrder, l.ID)
+	}
+
+	// Only links present on both sides can have moved
+	for i := range currentOrder {
+		if currentOrder[i] != incomingOrder[i] {
+			diff.Reordered = true
+			break
+		}
+	}
+
+	// A nil queue is left alone by the import
+	if incoming.ScheduledBanners != nil {
+		diff.BannersAdded, diff.BannersRemoved, diff.BannersUpdated = compareScheduledBanners(current.ScheduledBanners, incoming.ScheduledBanners)
+	}
+
+	return diff
+}
+
+func compareScheduledBanners(current, incoming []models.ScheduledBanner) (added, removed []models.ScheduledBanner, updated []models.BannerChange) {
+	existing := make(map[string]models.ScheduledBanner, len(current))
+	for _, b := range current {
+		existing[b.ID] = b
+	}
+	kept := make(map[string]bool, len(incoming))
+	for _, b := range incoming {
+		kept[b.ID] = true
+		old, ok := existing[b.ID]
+		if !ok {
+			added = append(added, b)
+			continue
+		}
+		if changes := compareFields(scheduledBannerFields(old), scheduledBannerFields(b)); len(changes) > 0 {
+			updated = append(updated, models.BannerChange{ID: b.ID, Text: b.Text, Changes: changes})
+		}
+	}
+	for _, b := range current {
+		if !kept[b.ID] {
+			removed = append(removed, b)
+		}
+	}
+	return added, removed, updated
+}
+
+type field struct {
+	name  string
+	value string
+}
+
+func compareFields(from, to []field) []models.FieldChange {
+	var changes []models.FieldChange
+	for i := range from {
+		if from[i].value != to[i].value {
+			changes = append(changes, models.FieldChange{Field: from[i].name, From: from[i].value, To: to[i].value})
+		}
+	}
+	return changes
+}
+
+func profileFields(p models.Profile) []field {
+	return []field{
+		{"Name", p.Name},
+		{"Title", p.Title},
+		{"Subtitle", p.Subtitle},
+		{"Description", p.Description},
+		{"Avatar", p.Avatar},
+	}
+}
+
+func bannerFields(b models.Banner) []field {
+	return []field{
+		{"Enabled", strconv.FormatBool(b.Enabled)},
+		{"Text", b.Text},
+		{"Link", b.Link},
+		{"Style", b.Type},
+	}
+}
+
+func scheduledBannerFields(b models.ScheduledBanner) []field {
+	return []field{
+		{"Text", b.Text},
+		{"Link", b.Link},
+		{"Style", b.Type},
+		{"Priority", strconv.Itoa(b.Priority)},
+		{"Starts at", formatTime(b.StartsAt)},
+		{"Ends at", formatTime(b.EndsAt)},
+	}
+}
+
+func linkFields(l models.Link) []field {
+	return []field{
+		{"Title", l.Title},
+		{"URL", l.URL},
+		{"Category", l.Category},
+		{"Icon", l.Icon},
+		{"Featured", strconv.FormatBool(l.Featured)},
+		{"Publish at", formatTime(l.PublishAt)},
+		{"Expires at", formatTime(l.ExpiresAt)},
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
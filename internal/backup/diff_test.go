@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func TestCompare(t *testing.T) {
+	current := models.Content{
+		Profile: models.Profile{Name: "Old"},
+		Links: []models.Link{
+			{ID: "a", Title: "A", URL: "https://a"},
+			{ID: "b", Title: "B", URL: "https://b"},
+			{ID: "c", Title: "C", URL: "https://c"},
+		},
+		Banner: models.Banner{Type: "info"},
+	}
+	incoming := models.Content{
+		Profile: models.Profile{Name: "New"},
+		Links: []models.Link{
+			{ID: "b", Title: "B", URL: "https://b"},
+			{ID: "a", Title: "A2", URL: "https://a"},
+			{ID: "d", Title: "D", URL: "https://d"},
+		},
+		Banner: models.Banner{Type: "info"},
+	}
+
+	diff := Compare(current, incoming)
+
+	if len(diff.Profile) != 1 || diff.Profile[0].Field != "Name" || diff.Profile[0].To != "New" {
+		t.Errorf("unexpected profile changes %+v", diff.Profile)
+	}
+	if len(diff.Banner) != 0 {
+		t.Errorf("expected no banner changes, got %+v", diff.Banner)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ID != "d" {
+		t.Errorf("expected d to be added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != "c" {
+		t.Errorf("expected c to be removed, got %+v", diff.Removed)
+	}
+	if len(diff.Updated) != 1 || diff.Updated[0].ID != "a" || diff.Updated[0].Changes[0].Field != "Title" {
+		t.Errorf("expected a's title to change, got %+v", diff.Updated)
+	}
+	if !diff.Reordered {
+		t.Error("expected a and b to be reported as reordered")
+	}
+	if diff.Empty() {
+		t.Error("expected diff to be non-empty")
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	c := models.Content{
+		Profile: models.Profile{Name: "Same"},
+		Links:   []models.Link{{ID: "a", Title: "A"}, {ID: "b", Title: "B"}},
+	}
+	if diff := Compare(c, c); !diff.Empty() {
+		t.Errorf("expected empty diff, got %+v", diff)
+	}
+
+	// Removing a link does not count as reordering the rest
+	smaller := c
+	smaller.Links = c.Links[1:]
+	if diff := Compare(c, smaller); diff.Reordered {
+		t.Error("expected removal alone not to be reported as a reorder")
+	}
+}
+
+func TestCompareScheduledBanners(t *testing.T) {
+	current := models.Content{ScheduledBanners: []models.ScheduledBanner{
+		{ID: "a", Text: "A", Type: "info"},
+		{ID: "b", Text: "B", Type: "info"},
+	}}
+	incoming := models.Content{ScheduledBanners: []models.ScheduledBanner{
+		{ID: "a", Text: "A", Type: "urgent"},
+		{ID: "c", Text: "C", Type: "info"},
+	}}
+
+	diff := Compare(current, incoming)
+
+	if len(diff.BannersAdded) != 1 || diff.BannersAdded[0].ID != "c" {
+		t.Errorf("expected c to be added, got %+v", diff.BannersAdded)
+	}
+	if len(diff.BannersRemoved) != 1 || diff.BannersRemoved[0].ID != "b" {
+		t.Errorf("expected b to be removed, got %+v", diff.BannersRemoved)
+	}
+	if len(diff.BannersUpdated) != 1 || diff.BannersUpdated[0].Changes[0].Field != "Style" {
+		t.Errorf("expected a's style to change, got %+v", diff.BannersUpdated)
+	}
+
+	// A document without a banner queue leaves it alone
+	if diff := Compare(current, models.Content{}); !diff.Empty() {
+		t.Errorf("expected empty diff, got %+v", diff)
+	}
+}
@@ -2,11 +2,23 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexraskin/standwithiran/internal/models"
 )
 
+// The entities the cache holds, as reported by Stats.
+const (
+	EntityProfile          = "profile"
+	EntityLinks            = "links"
+	EntityBanner           = "banner"
+	EntityScheduledBanners = "scheduled_banners"
+	EntityLinkHealth       = "link_health"
+)
+
+var entities = []string{EntityProfile, EntityLinks, EntityBanner, EntityScheduledBanners, EntityLinkHealth}
+
 type Cache struct {
 	mu         sync.RWMutex
 	profile    *models.Profile
@@ -15,11 +27,44 @@ type Cache struct {
 	linksExp   time.Time
 	banner     *models.Banner
 	bannerExp  time.Time
+	banners    []models.ScheduledBanner
+	bannersExp time.Time
+	health     map[string]models.LinkHealth
+	healthExp  time.Time
 	ttl        time.Duration
+	// hits and misses count lookups per entity. The maps are filled in
+	// NewCache and never written again, so reading them needs no lock.
+	hits   map[string]*atomic.Uint64
+	misses map[string]*atomic.Uint64
 }
 
 func NewCache(ttl time.Duration) *Cache {
-	return &Cache{ttl: ttl}
+	c := &Cache{
+		ttl:    ttl,
+		hits:   make(map[string]*atomic.Uint64, len(entities)),
+		misses: make(map[string]*atomic.Uint64, len(entities)),
+	}
+	for _, e := range entities {
+		c.hits[e] = new(atomic.Uint64)
+		c.misses[e] = new(atomic.Uint64)
+	}
+	return c
+}
+
+// EntityStats counts the lookups of one entity since the cache was created.
+type EntityStats struct {
+	Entity string
+	Hits   uint64
+	Misses uint64
+}
+
+// Stats returns the hit and miss counts for every entity.
+func (c *Cache) Stats() []EntityStats {
+	stats := make([]EntityStats, 0, len(entities))
+	for _, e := range entities {
+		stats = append(stats, EntityStats{Entity: e, Hits: c.hits[e].Load(), Misses: c.misses[e].Load()})
+	}
+	return stats
 }
 
 func (c *Cache) GetProfile() (*models.Profile, bool) {
@@ -27,8 +72,10 @@ func (c *Cache) GetProfile() (*models.Profile, bool) {
 	defer c.mu.RUnlock()
 
 	if c.profile == nil || time.Now().After(c.profileExp) {
+		c.misses[EntityProfile].Add(1)
 		return nil, false
 	}
+	c.hits[EntityProfile].Add(1)
 	return c.profile, true
 }
 
@@ -45,8 +92,10 @@ func (c *Cache) GetLinks() ([]models.Link, bool) {
 	defer c.mu.RUnlock()
 
 	if c.links == nil || time.Now().After(c.linksExp) {
+		c.misses[EntityLinks].Add(1)
 		return nil, false
 	}
+	c.hits[EntityLinks].Add(1)
 	return c.links, true
 }
 
@@ -63,8 +112,10 @@ func (c *Cache) GetBanner() (*models.Banner, bool) {
 	defer c.mu.RUnlock()
 
 	if c.banner == nil || time.Now().After(c.bannerExp) {
+		c.misses[EntityBanner].Add(1)
 		return nil, false
 	}
+	c.hits[EntityBanner].Add(1)
 	return c.banner, true
 }
 
@@ -76,6 +127,46 @@ func (c *Cache) SetBanner(b models.Banner) {
 	c.bannerExp = time.Now().Add(c.ttl)
 }
 
+func (c *Cache) GetScheduledBanners() ([]models.ScheduledBanner, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.banners == nil || time.Now().After(c.bannersExp) {
+		c.misses[EntityScheduledBanners].Add(1)
+		return nil, false
+	}
+	c.hits[EntityScheduledBanners].Add(1)
+	return c.banners, true
+}
+
+func (c *Cache) SetScheduledBanners(banners []models.ScheduledBanner) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.banners = banners
+	c.bannersExp = time.Now().Add(c.ttl)
+}
+
+func (c *Cache) GetLinkHealth() (map[string]models.LinkHealth, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.health == nil || time.Now().After(c.healthExp) {
+		c.misses[EntityLinkHealth].Add(1)
+		return nil, false
+	}
+	c.hits[EntityLinkHealth].Add(1)
+	return c.health, true
+}
+
+func (c *Cache) SetLinkHealth(health map[string]models.LinkHealth) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.health = health
+	c.healthExp = time.Now().Add(c.ttl)
+}
+
 func (c *Cache) InvalidateProfile() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -93,3 +184,15 @@ func (c *Cache) InvalidateBanner() {
 	defer c.mu.Unlock()
 	c.banner = nil
 }
+
+func (c *Cache) InvalidateScheduledBanners() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.banners = nil
+}
+
+func (c *Cache) InvalidateLinkHealth() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health = nil
+}
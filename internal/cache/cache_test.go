@@ -145,6 +145,44 @@ func TestCacheBanner(t *testing.T) {
 	}
 }
 
+func TestCacheScheduledBanners(t *testing.T) {
+	c := NewCache(1 * time.Hour)
+
+	if _, ok := c.GetScheduledBanners(); ok {
+		t.Error("expected empty banners cache")
+	}
+
+	// An empty list is still a cached result
+	c.SetScheduledBanners([]models.ScheduledBanner{})
+	if _, ok := c.GetScheduledBanners(); !ok {
+		t.Error("expected empty banner list to be cached")
+	}
+
+	c.InvalidateScheduledBanners()
+	if _, ok := c.GetScheduledBanners(); ok {
+		t.Error("expected banners cache to be invalidated")
+	}
+}
+
+func TestCacheLinkHealth(t *testing.T) {
+	c := NewCache(1 * time.Hour)
+
+	if _, ok := c.GetLinkHealth(); ok {
+		t.Error("expected empty link health cache")
+	}
+
+	c.SetLinkHealth(map[string]models.LinkHealth{"1": {LinkID: "1", Failures: 2}})
+	health, ok := c.GetLinkHealth()
+	if !ok || health["1"].Failures != 2 {
+		t.Errorf("expected link health to be cached, got %v", health)
+	}
+
+	c.InvalidateLinkHealth()
+	if _, ok := c.GetLinkHealth(); ok {
+		t.Error("expected link health cache to be invalidated")
+	}
+}
+
 func TestCacheConcurrency(t *testing.T) {
 	c := NewCache(1 * time.Hour)
 
@@ -179,3 +217,27 @@ func TestCacheConcurrency(t *testing.T) {
 		<-done
 	}
 }
+
+func TestCacheStats(t *testing.T) {
+	c := NewCache(1 * time.Hour)
+
+	c.GetLinks()
+	c.SetLinks([]models.Link{{ID: "a"}})
+	c.GetLinks()
+	c.GetLinks()
+	c.GetProfile()
+
+	stats := make(map[string]EntityStats)
+	for _, s := range c.Stats() {
+		stats[s.Entity] = s
+	}
+	if len(stats) != 5 {
+		t.Errorf("expected stats for every entity, got %+v", stats)
+	}
+	if s := stats[EntityLinks]; s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss for links, got %+v", s)
+	}
+	if s := stats[EntityProfile]; s.Hits != 0 || s.Misses != 1 {
+		t.Errorf("expected 1 miss for the profile, got %+v", s)
+	}
+}
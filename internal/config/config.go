@@ -0,0 +1,96 @@
+// Package config loads the runtime configuration shared by every CLI
+// subcommand from the environment.
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	DatabaseURL      string
+	Port             string
+	MigrateOnStartup bool
+	// AnalyticsRetentionDays is how long daily analytics counters are kept.
+	AnalyticsRetentionDays int
+	// LinkCheckInterval is how often every link is checked for dead pages;
+	// zero disables the checker.
+	LinkCheckInterval time.Duration
+	// LinkCheckFailures is the number of consecutive failed checks after
+	// which a link is flagged as broken.
+	LinkCheckFailures int
+	// HideBrokenLinks removes flagged links from the public page.
+	HideBrokenLinks bool
+	// SessionStore is where admin sessions are kept: "database" so they
+	// survive restarts and are shared by replicas, or "memory".
+	SessionStore string
+	// HSTSMaxAge is how long browsers should insist on HTTPS for the site;
+	// zero leaves out the Strict-Transport-Security header.
+	HSTSMaxAge time.Duration
+	// CSPReportOnly sends the Content-Security-Policy in report-only mode,
+	// so violations are logged without anything being blocked.
+	CSPReportOnly bool
+	// ShutdownDelay is how long /ready fails before the server stops
+	// accepting connections, giving load balancers time to notice.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish on
+	// shutdown before their connections are closed.
+	ShutdownTimeout time.Duration
+	// MetricsToken, if set, must be sent as a bearer token to read
+	// /metrics.
+	MetricsToken string
+	// TrustedProxies lists the reverse proxies, as addresses or CIDR
+	// ranges, whose forwarded headers give the client's address.
+	TrustedProxies string
+}
+
+func Load() Config {
+	return Config{
+		DatabaseURL:            getEnv("DATABASE_URL", "postgres://localhost:5432/iran?sslmode=disable"),
+		Port:                   getEnv("PORT", "8080"),
+		MigrateOnStartup:       os.Getenv("MIGRATE_ON_STARTUP") != "false",
+		AnalyticsRetentionDays: getEnvInt("ANALYTICS_RETENTION_DAYS", 90),
+		LinkCheckInterval:      getEnvDuration("LINK_CHECK_INTERVAL", 6*time.Hour),
+		LinkCheckFailures:      getEnvInt("LINK_CHECK_FAILURES", 3),
+		HideBrokenLinks:        os.Getenv("HIDE_BROKEN_LINKS") == "true",
+		SessionStore:           getEnv("SESSION_STORE", "database"),
+		HSTSMaxAge:             getEnvDuration("HSTS_MAX_AGE", 365*24*time.Hour),
+		CSPReportOnly:          os.Getenv("CSP_REPORT_ONLY") == "true",
+		ShutdownDelay:          getEnvDuration("SHUTDOWN_DELAY", 0),
+		ShutdownTimeout:        getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		MetricsToken:           os.Getenv("METRICS_TOKEN"),
+		TrustedProxies:         os.Getenv("TRUSTED_PROXIES"),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt reads a positive integer, falling back on a missing or invalid
+// value.
+func getEnvInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 1 {
+		return fallback
+	}
+	return n
+}
+
+// getEnvDuration reads a duration such as "6h". "0" and "off" return zero;
+// a missing or invalid value returns fallback.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "0" || value == "off" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("PORT", "")
+	t.Setenv("MIGRATE_ON_STARTUP", "")
+	t.Setenv("ANALYTICS_RETENTION_DAYS", "")
+	t.Setenv("LINK_CHECK_INTERVAL", "")
+	t.Setenv("LINK_CHECK_FAILURES", "")
+	t.Setenv("HIDE_BROKEN_LINKS", "")
+	t.Setenv("SESSION_STORE", "")
+	t.Setenv("HSTS_MAX_AGE", "")
+	t.Setenv("CSP_REPORT_ONLY", "")
+	t.Setenv("SHUTDOWN_DELAY", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	t.Setenv("METRICS_TOKEN", "")
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	cfg := Load()
+	if cfg.DatabaseURL != "postgres://localhost:5432/iran?sslmode=disable" {
+		t.Errorf("unexpected default database URL %q", cfg.DatabaseURL)
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("expected default port 8080, got %q", cfg.Port)
+	}
+	if !cfg.MigrateOnStartup {
+		t.Error("expected migrations to run on startup by default")
+	}
+	if cfg.AnalyticsRetentionDays != 90 {
+		t.Errorf("expected default retention of 90 days, got %d", cfg.AnalyticsRetentionDays)
+	}
+	if cfg.LinkCheckInterval != 6*time.Hour || cfg.LinkCheckFailures != 3 || cfg.HideBrokenLinks {
+		t.Errorf("unexpected link check defaults %+v", cfg)
+	}
+	if cfg.SessionStore != "database" {
+		t.Errorf("expected sessions to be stored in the database by default, got %q", cfg.SessionStore)
+	}
+	if cfg.HSTSMaxAge != 365*24*time.Hour || cfg.CSPReportOnly {
+		t.Errorf("unexpected security header defaults %+v", cfg)
+	}
+	if cfg.ShutdownDelay != 0 || cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("unexpected shutdown defaults %+v", cfg)
+	}
+	if cfg.MetricsToken != "" {
+		t.Errorf("expected /metrics to be open by default, got token %q", cfg.MetricsToken)
+	}
+	if cfg.TrustedProxies != "" {
+		t.Errorf("expected no trusted proxies by default, got %q", cfg.TrustedProxies)
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("DATABASE_URL", "memory://")
+	t.Setenv("PORT", "9090")
+	t.Setenv("MIGRATE_ON_STARTUP", "false")
+	t.Setenv("ANALYTICS_RETENTION_DAYS", "30")
+
+	cfg := Load()
+	if cfg.DatabaseURL != "memory://" || cfg.Port != "9090" || cfg.MigrateOnStartup || cfg.AnalyticsRetentionDays != 30 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoadInvalidRetention(t *testing.T) {
+	t.Setenv("ANALYTICS_RETENTION_DAYS", "-5")
+
+	if cfg := Load(); cfg.AnalyticsRetentionDays != 90 {
+		t.Errorf("expected invalid retention to fall back to 90, got %d", cfg.AnalyticsRetentionDays)
+	}
+}
+
+func TestLoadLinkCheckSettings(t *testing.T) {
+	t.Setenv("LINK_CHECK_INTERVAL", "30m")
+	t.Setenv("LINK_CHECK_FAILURES", "5")
+	t.Setenv("HIDE_BROKEN_LINKS", "true")
+
+	cfg := Load()
+	if cfg.LinkCheckInterval != 30*time.Minute || cfg.LinkCheckFailures != 5 || !cfg.HideBrokenLinks {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("LINK_CHECK_INTERVAL", "off")
+	if cfg := Load(); cfg.LinkCheckInterval != 0 {
+		t.Errorf("expected the checker to be disabled, got %v", cfg.LinkCheckInterval)
+	}
+}
+
+func TestLoadSecurityHeaderSettings(t *testing.T) {
+	t.Setenv("HSTS_MAX_AGE", "off")
+	t.Setenv("CSP_REPORT_ONLY", "true")
+
+	cfg := Load()
+	if cfg.HSTSMaxAge != 0 || !cfg.CSPReportOnly {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoadShutdownSettings(t *testing.T) {
+	t.Setenv("SHUTDOWN_DELAY", "5s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "2m")
+
+	cfg := Load()
+	if cfg.ShutdownDelay != 5*time.Second || cfg.ShutdownTimeout != 2*time.Minute {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
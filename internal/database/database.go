@@ -2,28 +2,94 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/alexraskin/standwithiran/internal/cache"
 	"github.com/alexraskin/standwithiran/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Database interface {
 	Close()
+	Ping(ctx context.Context) error
+	Migrate(ctx context.Context) error
+	// SchemaVersion returns the newest applied migration and the newest one
+	// this binary ships, which differ until Migrate has run.
+	SchemaVersion(ctx context.Context) (applied, latest int, err error)
+	Stats() Stats
 	GetProfile(ctx context.Context) (models.Profile, error)
 	UpdateProfile(ctx context.Context, p models.Profile) error
 	GetLinks(ctx context.Context) ([]models.Link, error)
 	AddLink(ctx context.Context, l models.Link) error
+	AddLinks(ctx context.Context, links []models.Link) error
+	UpdateLink(ctx context.Context, l models.Link) error
 	DeleteLink(ctx context.Context, id string) error
 	UpdateLinkFeatured(ctx context.Context, id string, featured bool) error
-	VerifyPassword(ctx context.Context, password string) (bool, error)
-	SetPassword(ctx context.Context, password string) error
+	ReorderLinks(ctx context.Context, ids []string) error
+	AuthenticateUser(ctx context.Context, username, password string) (models.User, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
+	GetUsers(ctx context.Context) ([]models.User, error)
+	AddUser(ctx context.Context, u models.User, password string) error
+	SetUserPassword(ctx context.Context, username, password string) error
+	SetUserRole(ctx context.Context, username, role string) error
+	DeleteUser(ctx context.Context, username string) error
+	GetTOTPSecret(ctx context.Context, username string) (string, error)
+	EnableTOTP(ctx context.Context, username, secret string, step int64, recoveryHashes []string) error
+	DisableTOTP(ctx context.Context, username string) error
+	UseTOTPStep(ctx context.Context, username string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, username, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, username string) (int, error)
+	CreateSession(ctx context.Context, hash string, s models.Session) error
+	GetSession(ctx context.Context, hash string) (models.Session, error)
+	ListSessions(ctx context.Context, now time.Time) ([]models.Session, error)
+	UpdateSession(ctx context.Context, hash string, s models.Session) error
+	DeleteSession(ctx context.Context, hash string) error
+	DeleteUserSessions(ctx context.Context, username, keep string) (int, error)
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error)
 	GetBanner(ctx context.Context) (models.Banner, error)
 	UpdateBanner(ctx context.Context, b models.Banner) error
+	ReplaceContent(ctx context.Context, c models.Content) error
+	RecordClick(ctx context.Context, linkID string) error
+	GetClickCounts(ctx context.Context) (map[string]int, error)
+	IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error
+	GetAnalytics(ctx context.Context, since string) ([]models.AnalyticsRow, error)
+	PruneAnalytics(ctx context.Context, before string) error
+	GetLinkHealth(ctx context.Context) (map[string]models.LinkHealth, error)
+	UpdateLinkHealth(ctx context.Context, h models.LinkHealth) error
+	GetScheduledBanners(ctx context.Context) ([]models.ScheduledBanner, error)
+	AddScheduledBanner(ctx context.Context, b models.ScheduledBanner) error
+	DeleteScheduledBanner(ctx context.Context, id string) error
+	RecordLoginFailure(ctx context.Context, f models.LoginFailure) error
+	GetLoginFailures(ctx context.Context, limit int) ([]models.LoginFailure, error)
+	PruneLoginFailures(ctx context.Context, before time.Time) (int, error)
+}
+
+var ErrLinkNotFound = errors.New("link not found")
+
+// Stats is a snapshot of a backend's connection pool and cache for metrics.
+type Stats struct {
+	// Pool is nil for backends without a connection pool.
+	Pool  *PoolStats
+	Cache []cache.EntityStats
+}
+
+// PoolStats mirrors the pgxpool statistics.
+type PoolStats struct {
+	MaxConns      int32
+	TotalConns    int32
+	IdleConns     int32
+	AcquiredConns int32
+	// AcquireCount and AcquireDuration cover every successful acquire;
+	// EmptyAcquireCount counts the ones that had to wait for a connection.
+	AcquireCount         int64
+	AcquireDuration      time.Duration
+	EmptyAcquireCount    int64
+	CanceledAcquireCount int64
 }
 
 type database struct {
@@ -63,6 +129,27 @@ func (d *database) Close() {
 	d.db.Close()
 }
 
+func (d *database) Ping(ctx context.Context) error {
+	return d.db.Ping(ctx)
+}
+
+func (d *database) Stats() Stats {
+	stat := d.db.Stat()
+	return Stats{
+		Pool: &PoolStats{
+			MaxConns:             stat.MaxConns(),
+			TotalConns:           stat.TotalConns(),
+			IdleConns:            stat.IdleConns(),
+			AcquiredConns:        stat.AcquiredConns(),
+			AcquireCount:         stat.AcquireCount(),
+			AcquireDuration:      stat.AcquireDuration(),
+			EmptyAcquireCount:    stat.EmptyAcquireCount(),
+			CanceledAcquireCount: stat.CanceledAcquireCount(),
+		},
+		Cache: d.cache.Stats(),
+	}
+}
+
 func (d *database) GetProfile(ctx context.Context) (models.Profile, error) {
 	if p, ok := d.cache.GetProfile(); ok {
 		return *p, nil
@@ -93,7 +180,7 @@ func (d *database) GetLinks(ctx context.Context) ([]models.Link, error) {
 		return links, nil
 	}
 
-	rows, err := d.db.Query(ctx, `SELECT id, title, url, category, icon, featured FROM links ORDER BY featured DESC, sort_order, created_at DESC`)
+	rows, err := d.db.Query(ctx, `SELECT id, title, url, category, icon, featured, publish_at, expires_at FROM links ORDER BY featured DESC, sort_order, created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +189,7 @@ func (d *database) GetLinks(ctx context.Context) ([]models.Link, error) {
 	var links []models.Link
 	for rows.Next() {
 		var l models.Link
-		if err := rows.Scan(&l.ID, &l.Title, &l.URL, &l.Category, &l.Icon, &l.Featured); err != nil {
+		if err := rows.Scan(&l.ID, &l.Title, &l.URL, &l.Category, &l.Icon, &l.Featured, &l.PublishAt, &l.ExpiresAt); err != nil {
 			return nil, err
 		}
 		links = append(links, l)
@@ -115,19 +202,60 @@ func (d *database) GetLinks(ctx context.Context) ([]models.Link, error) {
 	return links, nil
 }
 
+// AddLink appends l after every existing link.
 func (d *database) AddLink(ctx context.Context, l models.Link) error {
-	_, err := d.db.Exec(ctx, `INSERT INTO links (id, title, url, category, icon, featured) VALUES ($1, $2, $3, $4, $5, $6)`,
-		l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured)
+	_, err := d.db.Exec(ctx, `INSERT INTO links (id, title, url, category, icon, featured, publish_at, expires_at, sort_order)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8, COALESCE(MAX(sort_order), -1) + 1 FROM links`,
+		l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured, l.PublishAt, l.ExpiresAt)
 	if err == nil {
 		d.cache.InvalidateLinks()
 	}
 	return err
 }
 
+// AddLinks appends all links, in order, in one transaction; if any insert
+// fails none of them are kept.
+func (d *database) AddLinks(ctx context.Context, links []models.Link) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	for _, l := range links {
+		if _, err := tx.Exec(ctx, `INSERT INTO links (id, title, url, category, icon, featured, publish_at, expires_at, sort_order)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8, COALESCE(MAX(sort_order), -1) + 1 FROM links`,
+			l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured, l.PublishAt, l.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	d.cache.InvalidateLinks()
+	return nil
+}
+
+func (d *database) UpdateLink(ctx context.Context, l models.Link) error {
+	tag, err := d.db.Exec(ctx, `UPDATE links SET title = $1, url = $2, category = $3, icon = $4, featured = $5, publish_at = $6, expires_at = $7 WHERE id = $8`,
+		l.Title, l.URL, l.Category, l.Icon, l.Featured, l.PublishAt, l.ExpiresAt, l.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLinkNotFound
+	}
+	d.cache.InvalidateLinks()
+	return nil
+}
+
 func (d *database) DeleteLink(ctx context.Context, id string) error {
 	_, err := d.db.Exec(ctx, `DELETE FROM links WHERE id = $1`, id)
 	if err == nil {
 		d.cache.InvalidateLinks()
+		d.cache.InvalidateLinkHealth()
 	}
 	return err
 }
@@ -140,32 +268,31 @@ func (d *database) UpdateLinkFeatured(ctx context.Context, id string, featured b
 	return err
 }
 
-func (d *database) VerifyPassword(ctx context.Context, password string) (bool, error) {
-	var hashedPassword string
-	err := d.db.QueryRow(ctx, `SELECT value FROM settings WHERE key = 'admin_password'`).Scan(&hashedPassword)
+// ReorderLinks writes the position of every link in ids to sort_order in a
+// single transaction, so a failed reorder leaves the previous order intact.
+func (d *database) ReorderLinks(ctx context.Context, ids []string) error {
+	tx, err := d.db.Begin(ctx)
 	if err != nil {
-		return false, err
+		return err
 	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	if len(hashedPassword) < 60 {
-		if password == hashedPassword {
-			_ = d.SetPassword(ctx, password)
-			return true, nil
+	for i, id := range ids {
+		tag, err := tx.Exec(ctx, `UPDATE links SET sort_order = $1 WHERE id = $2`, i, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrLinkNotFound
 		}
-		return false, nil
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil, nil
-}
-
-func (d *database) SetPassword(ctx context.Context, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		return err
 	}
-	_, err = d.db.Exec(ctx, `UPDATE settings SET value = $1 WHERE key = 'admin_password'`, string(hashedPassword))
-	return err
+
+	d.cache.InvalidateLinks()
+	return nil
 }
 
 func (d *database) GetBanner(ctx context.Context) (models.Banner, error) {
@@ -204,25 +331,275 @@ func (d *database) GetBanner(ctx context.Context) (models.Banner, error) {
 	return b, rows.Err()
 }
 
+// txBeginner is the part of *pgxpool.Pool the transactional writes need, so
+// tests can substitute a transaction that fails partway through.
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 func (d *database) UpdateBanner(ctx context.Context, b models.Banner) error {
-	enabled := "false"
-	if b.Enabled {
-		enabled = "true"
+	// Invalidate even on failure: a failed commit may still have been applied.
+	defer d.cache.InvalidateBanner()
+	return updateBanner(ctx, d.db, b)
+}
+
+// updateBanner writes every banner setting in one transaction, so a failure
+// leaves the previous banner intact.
+func updateBanner(ctx context.Context, db txBeginner, b models.Banner) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	if _, err := d.db.Exec(ctx, `INSERT INTO settings (key, value) VALUES ('banner_enabled', $1) ON CONFLICT (key) DO UPDATE SET value = $1`, enabled); err != nil {
+	if err := writeBanner(ctx, tx, b); err != nil {
 		return err
 	}
-	if _, err := d.db.Exec(ctx, `INSERT INTO settings (key, value) VALUES ('banner_text', $1) ON CONFLICT (key) DO UPDATE SET value = $1`, b.Text); err != nil {
+	return tx.Commit(ctx)
+}
+
+func writeBanner(ctx context.Context, tx pgx.Tx, b models.Banner) error {
+	for _, s := range bannerSettings(b) {
+		if _, err := tx.Exec(ctx, `INSERT INTO settings (key, value) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET value = $2`, s.key, s.value); err != nil {
+			return fmt.Errorf("failed to save %s: %w", s.key, err)
+		}
+	}
+	return nil
+}
+
+type setting struct {
+	key   string
+	value string
+}
+
+// bannerSettings lists the settings rows that store b.
+func bannerSettings(b models.Banner) []setting {
+	return []setting{
+		{"banner_enabled", strconv.FormatBool(b.Enabled)},
+		{"banner_text", b.Text},
+		{"banner_link", b.Link},
+		{"banner_type", b.Type},
+	}
+}
+
+// ReplaceContent swaps the profile, links, banner and, unless nil, the
+// scheduled banners for c in one transaction. Links keep their IDs and take
+// their position from c.Links.
+func (d *database) ReplaceContent(ctx context.Context, c models.Content) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
 		return err
 	}
-	if _, err := d.db.Exec(ctx, `INSERT INTO settings (key, value) VALUES ('banner_link', $1) ON CONFLICT (key) DO UPDATE SET value = $1`, b.Link); err != nil {
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	p := c.Profile
+	if _, err := tx.Exec(ctx, `UPDATE profile SET name=$1, title=$2, subtitle=$3, description=$4, avatar=$5 WHERE id=1`,
+		p.Name, p.Title, p.Subtitle, p.Description, p.Avatar); err != nil {
 		return err
 	}
-	if _, err := d.db.Exec(ctx, `INSERT INTO settings (key, value) VALUES ('banner_type', $1) ON CONFLICT (key) DO UPDATE SET value = $1`, b.Type); err != nil {
+
+	ids := make([]string, len(c.Links))
+	for i, l := range c.Links {
+		ids[i] = l.ID
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM links WHERE NOT (id = ANY($1))`, ids); err != nil {
+		return err
+	}
+	for i, l := range c.Links {
+		if _, err := tx.Exec(ctx, `INSERT INTO links (id, title, url, category, icon, featured, sort_order, publish_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (id) DO UPDATE SET title = $2, url = $3, category = $4, icon = $5, featured = $6, sort_order = $7,
+			publish_at = $8, expires_at = $9`,
+			l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured, i, l.PublishAt, l.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if err := writeBanner(ctx, tx, c.Banner); err != nil {
 		return err
 	}
 
+	if c.ScheduledBanners != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM banners`); err != nil {
+			return err
+		}
+		for _, b := range c.ScheduledBanners {
+			if _, err := tx.Exec(ctx, `INSERT INTO banners (id, text, link, type, priority, starts_at, ends_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				b.ID, b.Text, b.Link, b.Type, b.Priority, b.StartsAt, b.EndsAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	d.cache.InvalidateProfile()
+	d.cache.InvalidateLinks()
 	d.cache.InvalidateBanner()
+	d.cache.InvalidateScheduledBanners()
+	d.cache.InvalidateLinkHealth()
 	return nil
 }
+
+// RecordClick bumps today's counter for the link. Nothing about the visitor
+// is stored.
+func (d *database) RecordClick(ctx context.Context, linkID string) error {
+	day := time.Now().UTC().Format(time.DateOnly)
+	_, err := d.db.Exec(ctx, `INSERT INTO link_clicks (link_id, day, count) VALUES ($1, $2, 1)
+		ON CONFLICT (link_id, day) DO UPDATE SET count = link_clicks.count + 1`, linkID, day)
+	return err
+}
+
+func (d *database) GetClickCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := d.db.Query(ctx, `SELECT link_id, SUM(count) FROM link_clicks GROUP BY link_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+func (d *database) IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	for _, c := range counts {
+		if _, err := tx.Exec(ctx, `INSERT INTO analytics_daily (day, kind, referrer, count) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (day, kind, referrer) DO UPDATE SET count = analytics_daily.count + EXCLUDED.count`,
+			c.Day, c.Kind, c.Referrer, c.Count); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetAnalytics returns view and click totals per day and referrer for days
+// on or after since (YYYY-MM-DD).
+func (d *database) GetAnalytics(ctx context.Context, since string) ([]models.AnalyticsRow, error) {
+	rows, err := d.db.Query(ctx, `SELECT day::text, referrer,
+			SUM(CASE WHEN kind = 'view' THEN count ELSE 0 END),
+			SUM(CASE WHEN kind = 'click' THEN count ELSE 0 END)
+		FROM analytics_daily WHERE day >= $1
+		GROUP BY day, referrer ORDER BY day, referrer`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.AnalyticsRow
+	for rows.Next() {
+		var r models.AnalyticsRow
+		if err := rows.Scan(&r.Day, &r.Referrer, &r.Views, &r.Clicks); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// PruneAnalytics deletes the daily view and click counters for days before
+// the given date (YYYY-MM-DD). Per-link click totals are lifetime counts and
+// are kept.
+func (d *database) PruneAnalytics(ctx context.Context, before string) error {
+	_, err := d.db.Exec(ctx, `DELETE FROM analytics_daily WHERE day < $1`, before)
+	return err
+}
+
+func (d *database) GetLinkHealth(ctx context.Context) (map[string]models.LinkHealth, error) {
+	if health, ok := d.cache.GetLinkHealth(); ok {
+		return health, nil
+	}
+
+	rows, err := d.db.Query(ctx, `SELECT link_id, url, status_code, final_url, error, failures, checked_at FROM link_health`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	health := make(map[string]models.LinkHealth)
+	for rows.Next() {
+		var h models.LinkHealth
+		if err := rows.Scan(&h.LinkID, &h.URL, &h.StatusCode, &h.FinalURL, &h.Error, &h.Failures, &h.CheckedAt); err != nil {
+			return nil, err
+		}
+		health[h.LinkID] = h
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	d.cache.SetLinkHealth(health)
+	return health, nil
+}
+
+func (d *database) UpdateLinkHealth(ctx context.Context, h models.LinkHealth) error {
+	_, err := d.db.Exec(ctx, `INSERT INTO link_health (link_id, url, status_code, final_url, error, failures, checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (link_id) DO UPDATE SET url = EXCLUDED.url, status_code = EXCLUDED.status_code,
+			final_url = EXCLUDED.final_url, error = EXCLUDED.error, failures = EXCLUDED.failures, checked_at = EXCLUDED.checked_at`,
+		h.LinkID, h.URL, h.StatusCode, h.FinalURL, h.Error, h.Failures, h.CheckedAt)
+	if err == nil {
+		d.cache.InvalidateLinkHealth()
+	}
+	return err
+}
+
+func (d *database) GetScheduledBanners(ctx context.Context) ([]models.ScheduledBanner, error) {
+	if banners, ok := d.cache.GetScheduledBanners(); ok {
+		return banners, nil
+	}
+
+	rows, err := d.db.Query(ctx, `SELECT id, text, link, type, priority, starts_at, ends_at FROM banners ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	banners := []models.ScheduledBanner{}
+	for rows.Next() {
+		var b models.ScheduledBanner
+		if err := rows.Scan(&b.ID, &b.Text, &b.Link, &b.Type, &b.Priority, &b.StartsAt, &b.EndsAt); err != nil {
+			return nil, err
+		}
+		banners = append(banners, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	d.cache.SetScheduledBanners(banners)
+	return banners, nil
+}
+
+func (d *database) AddScheduledBanner(ctx context.Context, b models.ScheduledBanner) error {
+	_, err := d.db.Exec(ctx, `INSERT INTO banners (id, text, link, type, priority, starts_at, ends_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		b.ID, b.Text, b.Link, b.Type, b.Priority, b.StartsAt, b.EndsAt)
+	if err == nil {
+		d.cache.InvalidateScheduledBanners()
+	}
+	return err
+}
+
+func (d *database) DeleteScheduledBanner(ctx context.Context, id string) error {
+	_, err := d.db.Exec(ctx, `DELETE FROM banners WHERE id = $1`, id)
+	if err == nil {
+		d.cache.InvalidateScheduledBanners()
+	}
+	return err
+}
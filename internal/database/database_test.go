@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+// fakeTx records the statements of a transaction and fails the Nth Exec.
+// Methods the banner writer does not use panic through the nil embedded Tx.
+type fakeTx struct {
+	pgx.Tx
+	failAt     int
+	execs      []any
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if len(tx.execs)+1 == tx.failAt {
+		return pgconn.CommandTag{}, errors.New("connection reset")
+	}
+	tx.execs = append(tx.execs, args[0])
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+type fakeBeginner struct {
+	tx *fakeTx
+}
+
+func (b fakeBeginner) Begin(ctx context.Context) (pgx.Tx, error) {
+	return b.tx, nil
+}
+
+func TestUpdateBannerRollsBackMidWrite(t *testing.T) {
+	tx := &fakeTx{failAt: 3}
+	banner := models.Banner{Enabled: true, Text: "Rally", Link: "https://example.org", Type: "urgent"}
+
+	err := updateBanner(context.Background(), fakeBeginner{tx}, banner)
+	if err == nil {
+		t.Fatal("expected the injected error")
+	}
+	if len(tx.execs) != 2 {
+		t.Errorf("expected the write to stop at the failing statement, got %v", tx.execs)
+	}
+	if tx.committed || !tx.rolledBack {
+		t.Errorf("expected rollback without commit, committed=%v rolledBack=%v", tx.committed, tx.rolledBack)
+	}
+}
+
+func TestUpdateBannerCommitsAllSettings(t *testing.T) {
+	tx := &fakeTx{}
+	banner := models.Banner{Enabled: true, Text: "Rally", Link: "https://example.org", Type: "urgent"}
+
+	if err := updateBanner(context.Background(), fakeBeginner{tx}, banner); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.execs) != 4 || !tx.committed || tx.rolledBack {
+		t.Errorf("expected four writes in one committed transaction, got %v (committed=%v)", tx.execs, tx.committed)
+	}
+}
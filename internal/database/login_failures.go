@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func (d *database) RecordLoginFailure(ctx context.Context, f models.LoginFailure) error {
+	_, err := d.db.Exec(ctx, `INSERT INTO login_failures (username, address, user_agent, reason, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		f.Username, f.Address, f.UserAgent, f.Reason, f.At)
+	return err
+}
+
+// GetLoginFailures returns the most recent failures, newest first.
+func (d *database) GetLoginFailures(ctx context.Context, limit int) ([]models.LoginFailure, error) {
+	rows, err := d.db.Query(ctx, `SELECT username, address, user_agent, reason, created_at FROM login_failures ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []models.LoginFailure
+	for rows.Next() {
+		var f models.LoginFailure
+		if err := rows.Scan(&f.Username, &f.Address, &f.UserAgent, &f.Reason, &f.At); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+func (d *database) PruneLoginFailures(ctx context.Context, before time.Time) (int, error) {
+	tag, err := d.db.Exec(ctx, `DELETE FROM login_failures WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,719 @@
+// Package memory provides an in-process implementation of database.Database
+// for local development and tests. Nothing is persisted across restarts.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+// DefaultUsername and DefaultPassword match the owner account the SQL
+// migrations create from the original admin password.
+const (
+	DefaultUsername = "admin"
+	DefaultPassword = "changeme123"
+)
+
+type user struct {
+	models.User
+	hash       string
+	totpSecret string
+	totpStep   int64
+	recovery   map[string]bool
+}
+
+type link struct {
+	models.Link
+	sortOrder int
+	seq       int
+}
+
+type store struct {
+	mu       sync.RWMutex
+	profile  models.Profile
+	links    map[string]*link
+	seq      int
+	users    map[string]*user
+	banner   models.Banner
+	clicks   map[string]map[string]int
+	counters map[analyticsKey]int
+	health   map[string]models.LinkHealth
+	banners  []models.ScheduledBanner
+	sessions map[string]models.Session
+	failures []models.LoginFailure
+}
+
+type analyticsKey struct {
+	day      string
+	kind     string
+	referrer string
+}
+
+// New returns an empty database seeded with the same defaults as the SQL
+// migrations.
+func New() database.Database {
+	hash, err := database.HashPassword(DefaultPassword)
+	if err != nil {
+		panic("failed to hash default password: " + err.Error())
+	}
+	owner := &user{
+		User: models.User{Username: DefaultUsername, Role: models.RoleOwner, CreatedAt: time.Now().UTC()},
+		hash: hash,
+	}
+
+	return &store{
+		profile: models.Profile{
+			Name:        "Stand With Iran",
+			Title:       "Woman, Life, Freedom",
+			Subtitle:    "زن، زندگی، آزادی",
+			Description: "Supporting the people of Iran in their fight for freedom and human rights.",
+		},
+		links:    make(map[string]*link),
+		clicks:   make(map[string]map[string]int),
+		counters: make(map[analyticsKey]int),
+		health:   make(map[string]models.LinkHealth),
+		users:    map[string]*user{DefaultUsername: owner},
+		banner:   models.Banner{Type: "info"},
+		sessions: make(map[string]models.Session),
+	}
+}
+
+func (s *store) Close() {}
+
+func (s *store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Stats is empty: the store has neither a pool nor a cache.
+func (s *store) Stats() database.Stats {
+	return database.Stats{}
+}
+
+func (s *store) Migrate(ctx context.Context) error {
+	return nil
+}
+
+// SchemaVersion reports no migrations: the store has no schema to apply.
+func (s *store) SchemaVersion(ctx context.Context) (int, int, error) {
+	return 0, 0, nil
+}
+
+func (s *store) GetProfile(ctx context.Context) (models.Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.profile, nil
+}
+
+func (s *store) UpdateProfile(ctx context.Context, p models.Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = p
+	return nil
+}
+
+// GetLinks returns links in the same order as the SQL backends: featured
+// first, then by sort_order, then newest first.
+func (s *store) GetLinks(ctx context.Context) ([]models.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sorted := make([]*link, 0, len(s.links))
+	for _, l := range s.links {
+		sorted = append(sorted, l)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Featured != b.Featured {
+			return a.Featured
+		}
+		if a.sortOrder != b.sortOrder {
+			return a.sortOrder < b.sortOrder
+		}
+		return a.seq > b.seq
+	})
+
+	var links []models.Link
+	for _, l := range sorted {
+		links = append(links, l.Link)
+	}
+	return links, nil
+}
+
+func (s *store) AddLink(ctx context.Context, l models.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.links[l.ID]; exists {
+		return fmt.Errorf("link %q already exists", l.ID)
+	}
+	s.seq++
+	s.links[l.ID] = &link{Link: l, sortOrder: s.nextSortOrder(), seq: s.seq}
+	return nil
+}
+
+func (s *store) AddLinks(ctx context.Context, links []models.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]bool, len(links))
+	for _, l := range links {
+		if _, exists := s.links[l.ID]; exists || ids[l.ID] {
+			return fmt.Errorf("link %q already exists", l.ID)
+		}
+		ids[l.ID] = true
+	}
+	for _, l := range links {
+		s.seq++
+		s.links[l.ID] = &link{Link: l, sortOrder: s.nextSortOrder(), seq: s.seq}
+	}
+	return nil
+}
+
+// nextSortOrder places a new link after every existing one. The caller must
+// hold s.mu.
+func (s *store) nextSortOrder() int {
+	next := 0
+	for _, l := range s.links {
+		next = max(next, l.sortOrder+1)
+	}
+	return next
+}
+
+func (s *store) UpdateLink(ctx context.Context, l models.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.links[l.ID]
+	if !ok {
+		return database.ErrLinkNotFound
+	}
+	existing.Link = l
+	return nil
+}
+
+func (s *store) DeleteLink(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.links, id)
+	delete(s.clicks, id)
+	delete(s.health, id)
+	return nil
+}
+
+func (s *store) UpdateLinkFeatured(ctx context.Context, id string, featured bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.links[id]; ok {
+		l.Featured = featured
+	}
+	return nil
+}
+
+func (s *store) ReorderLinks(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := s.links[id]; !ok {
+			return database.ErrLinkNotFound
+		}
+	}
+	for i, id := range ids {
+		s.links[id].sortOrder = i
+	}
+	return nil
+}
+
+func (s *store) GetBanner(ctx context.Context) (models.Banner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.banner, nil
+}
+
+func (s *store) UpdateBanner(ctx context.Context, b models.Banner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.banner = b
+	return nil
+}
+
+func (s *store) ReplaceContent(ctx context.Context, c models.Content) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := make(map[string]*link, len(c.Links))
+	for i, l := range c.Links {
+		seq := 0
+		if existing, ok := s.links[l.ID]; ok {
+			seq = existing.seq
+		} else {
+			s.seq++
+			seq = s.seq
+		}
+		links[l.ID] = &link{Link: l, sortOrder: i, seq: seq}
+	}
+
+	for id := range s.clicks {
+		if _, ok := links[id]; !ok {
+			delete(s.clicks, id)
+		}
+	}
+	for id := range s.health {
+		if _, ok := links[id]; !ok {
+			delete(s.health, id)
+		}
+	}
+
+	s.profile = c.Profile
+	s.links = links
+	s.banner = c.Banner
+	if c.ScheduledBanners != nil {
+		s.banners = slices.Clone(c.ScheduledBanners)
+	}
+	return nil
+}
+
+func (s *store) RecordClick(ctx context.Context, linkID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[linkID]; !ok {
+		return database.ErrLinkNotFound
+	}
+	day := time.Now().UTC().Format(time.DateOnly)
+	if s.clicks[linkID] == nil {
+		s.clicks[linkID] = make(map[string]int)
+	}
+	s.clicks[linkID][day]++
+	return nil
+}
+
+func (s *store) GetClickCounts(ctx context.Context) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int, len(s.clicks))
+	for id, days := range s.clicks {
+		for _, n := range days {
+			counts[id] += n
+		}
+	}
+	return counts, nil
+}
+
+func (s *store) IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range counts {
+		s.counters[analyticsKey{day: c.Day, kind: c.Kind, referrer: c.Referrer}] += c.Count
+	}
+	return nil
+}
+
+func (s *store) GetAnalytics(ctx context.Context, since string) ([]models.AnalyticsRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type rowKey struct{ day, referrer string }
+	byKey := make(map[rowKey]*models.AnalyticsRow)
+	for k, n := range s.counters {
+		if k.day < since {
+			continue
+		}
+		row, ok := byKey[rowKey{k.day, k.referrer}]
+		if !ok {
+			row = &models.AnalyticsRow{Day: k.day, Referrer: k.referrer}
+			byKey[rowKey{k.day, k.referrer}] = row
+		}
+		switch k.kind {
+		case models.AnalyticsView:
+			row.Views += n
+		case models.AnalyticsClick:
+			row.Clicks += n
+		}
+	}
+
+	rows := make([]models.AnalyticsRow, 0, len(byKey))
+	for _, row := range byKey {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Day != rows[j].Day {
+			return rows[i].Day < rows[j].Day
+		}
+		return rows[i].Referrer < rows[j].Referrer
+	})
+	return rows, nil
+}
+
+func (s *store) PruneAnalytics(ctx context.Context, before string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k := range s.counters {
+		if k.day < before {
+			delete(s.counters, k)
+		}
+	}
+	return nil
+}
+
+func (s *store) GetLinkHealth(ctx context.Context) (map[string]models.LinkHealth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	health := make(map[string]models.LinkHealth, len(s.health))
+	for id, h := range s.health {
+		health[id] = h
+	}
+	return health, nil
+}
+
+func (s *store) UpdateLinkHealth(ctx context.Context, h models.LinkHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[h.LinkID]; !ok {
+		return database.ErrLinkNotFound
+	}
+	s.health[h.LinkID] = h
+	return nil
+}
+
+func (s *store) GetScheduledBanners(ctx context.Context) ([]models.ScheduledBanner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.banners), nil
+}
+
+func (s *store) AddScheduledBanner(ctx context.Context, b models.ScheduledBanner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.banners = append(s.banners, b)
+	return nil
+}
+
+func (s *store) DeleteScheduledBanner(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.banners = slices.DeleteFunc(s.banners, func(b models.ScheduledBanner) bool { return b.ID == id })
+	return nil
+}
+
+func (s *store) AuthenticateUser(ctx context.Context, username, password string) (models.User, error) {
+	s.mu.RLock()
+	var found models.User
+	var hash string
+	if u, ok := s.users[username]; ok {
+		found, hash = u.User, u.hash
+	}
+	s.mu.RUnlock()
+
+	if ok, _ := database.CheckPassword(hash, password); !ok {
+		return models.User{}, database.ErrInvalidCredentials
+	}
+	return found, nil
+}
+
+func (s *store) GetUser(ctx context.Context, username string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return models.User{}, database.ErrUserNotFound
+	}
+	return u.User, nil
+}
+
+func (s *store) GetUsers(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u.User)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (s *store) AddUser(ctx context.Context, u models.User, password string) error {
+	hash, err := database.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[u.Username]; ok {
+		return database.ErrUserExists
+	}
+	u.CreatedAt = time.Now().UTC()
+	s.users[u.Username] = &user{User: u, hash: hash}
+	return nil
+}
+
+func (s *store) SetUserPassword(ctx context.Context, username, password string) error {
+	hash, err := database.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	u.hash = hash
+	return nil
+}
+
+func (s *store) SetUserRole(ctx context.Context, username, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	if role != models.RoleOwner && s.lastOwner(u) {
+		return database.ErrLastOwner
+	}
+	u.Role = role
+	return nil
+}
+
+func (s *store) DeleteUser(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	if s.lastOwner(u) {
+		return database.ErrLastOwner
+	}
+	delete(s.users, username)
+	for hash, sess := range s.sessions {
+		if sess.Username == username {
+			delete(s.sessions, hash)
+		}
+	}
+	return nil
+}
+
+// lastOwner reports whether u is the only owner. s.mu must be held.
+func (s *store) lastOwner(u *user) bool {
+	if u.Role != models.RoleOwner {
+		return false
+	}
+	for _, other := range s.users {
+		if other != u && other.Role == models.RoleOwner {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *store) GetTOTPSecret(ctx context.Context, username string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return "", database.ErrUserNotFound
+	}
+	return u.totpSecret, nil
+}
+
+func (s *store) EnableTOTP(ctx context.Context, username, secret string, step int64, recoveryHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	u.totpSecret, u.totpStep, u.TwoFactor = secret, step, true
+	u.recovery = make(map[string]bool, len(recoveryHashes))
+	for _, h := range recoveryHashes {
+		u.recovery[h] = true
+	}
+	return nil
+}
+
+func (s *store) DisableTOTP(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	u.totpSecret, u.totpStep, u.TwoFactor, u.recovery = "", 0, false, nil
+	return nil
+}
+
+func (s *store) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || step <= u.totpStep {
+		return false, nil
+	}
+	u.totpStep = step
+	return true, nil
+}
+
+func (s *store) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok || !u.recovery[hash] {
+		return false, nil
+	}
+	delete(u.recovery, hash)
+	return true, nil
+}
+
+func (s *store) CountRecoveryCodes(ctx context.Context, username string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if u, ok := s.users[username]; ok {
+		return len(u.recovery), nil
+	}
+	return 0, nil
+}
+
+func (s *store) CreateSession(ctx context.Context, hash string, sess models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess.ID = hash
+	s.sessions[hash] = sess
+	return nil
+}
+
+func (s *store) GetSession(ctx context.Context, hash string) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, ok := s.sessions[hash]
+	if !ok {
+		return models.Session{}, database.ErrSessionNotFound
+	}
+	return sess, nil
+}
+
+func (s *store) ListSessions(ctx context.Context, now time.Time) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, sess := range s.sessions {
+		if !sess.Pending && sess.ExpiresAt.After(now) {
+			sessions = append(sessions, sess)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b models.Session) int { return b.LastSeenAt.Compare(a.LastSeenAt) })
+	return sessions, nil
+}
+
+func (s *store) UpdateSession(ctx context.Context, hash string, sess models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.sessions[hash]
+	if !ok {
+		return database.ErrSessionNotFound
+	}
+	old.LastSeenAt, old.ExpiresAt, old.CSRFToken = sess.LastSeenAt, sess.ExpiresAt, sess.CSRFToken
+	old.Pending, old.Attempts = sess.Pending, sess.Attempts
+	s.sessions[hash] = old
+	return nil
+}
+
+func (s *store) DeleteSession(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, hash)
+	return nil
+}
+
+func (s *store) DeleteUserSessions(ctx context.Context, username, keep string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for hash, sess := range s.sessions {
+		if sess.Username == username && hash != keep {
+			delete(s.sessions, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *store) DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for hash, sess := range s.sessions {
+		if sess.ExpiresAt.Before(before) {
+			delete(s.sessions, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *store) RecordLoginFailure(ctx context.Context, f models.LoginFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, f)
+	return nil
+}
+
+func (s *store) GetLoginFailures(ctx context.Context, limit int) ([]models.LoginFailure, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	failures := slices.Clone(s.failures)
+	slices.SortStableFunc(failures, func(a, b models.LoginFailure) int { return b.At.Compare(a.At) })
+	if len(failures) > limit {
+		failures = failures[:limit]
+	}
+	return failures, nil
+}
+
+func (s *store) PruneLoginFailures(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.failures)
+	s.failures = slices.DeleteFunc(s.failures, func(f models.LoginFailure) bool { return f.At.Before(before) })
+	return n - len(s.failures), nil
+}
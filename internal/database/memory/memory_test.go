@@ -0,0 +1,329 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func linkIDs(t *testing.T, db database.Database) []string {
+	t.Helper()
+	links, err := db.GetLinks(context.Background())
+	if err != nil {
+		t.Fatalf("GetLinks failed: %v", err)
+	}
+	ids := make([]string, len(links))
+	for i, l := range links {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDefaults(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	p, err := db.GetProfile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Stand With Iran" {
+		t.Errorf("expected default profile name, got %q", p.Name)
+	}
+
+	b, err := db.GetBanner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Enabled || b.Type != "info" {
+		t.Errorf("expected disabled info banner, got %+v", b)
+	}
+
+	links, err := db.GetLinks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 0 {
+		t.Errorf("expected no links, got %d", len(links))
+	}
+}
+
+func TestLinkOrdering(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	for _, l := range []models.Link{{ID: "a"}, {ID: "b"}, {ID: "c", Featured: true}} {
+		if err := db.AddLink(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Featured first, then in the order added
+	if got := linkIDs(t, db); !equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("unexpected order %v", got)
+	}
+
+	if err := db.ReorderLinks(ctx, []string{"c", "b", "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "b", "a"}) {
+		t.Errorf("unexpected order after reorder %v", got)
+	}
+
+	// A new link goes after the reordered ones
+	if err := db.AddLink(ctx, models.Link{ID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "b", "a", "d"}) {
+		t.Errorf("unexpected order after adding %v", got)
+	}
+
+	if err := db.UpdateLinkFeatured(ctx, "a", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "a", "b", "d"}) {
+		t.Errorf("unexpected order after featuring %v", got)
+	}
+}
+
+func TestReorderUnknownLinkIsAtomic(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "a"})
+	_ = db.AddLink(ctx, models.Link{ID: "b"})
+
+	err := db.ReorderLinks(ctx, []string{"a", "missing", "b"})
+	if !errors.Is(err, database.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"a", "b"}) {
+		t.Errorf("expected order to be unchanged, got %v", got)
+	}
+}
+
+func TestUpdateAndDeleteLink(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "Old"})
+	_ = db.AddLink(ctx, models.Link{ID: "b", Title: "Other"})
+
+	if err := db.AddLink(ctx, models.Link{ID: "a"}); err == nil {
+		t.Error("expected duplicate ID to be rejected")
+	}
+
+	if err := db.UpdateLink(ctx, models.Link{ID: "a", Title: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateLink(ctx, models.Link{ID: "missing"}); !errors.Is(err, database.ErrLinkNotFound) {
+		t.Errorf("expected ErrLinkNotFound, got %v", err)
+	}
+
+	links, _ := db.GetLinks(ctx)
+	if links[0].ID != "a" || links[0].Title != "New" {
+		t.Errorf("expected link to be updated in place, got %+v", links[0])
+	}
+
+	if err := db.DeleteLink(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"b"}) {
+		t.Errorf("expected only b to remain, got %v", got)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	u, err := db.AuthenticateUser(ctx, DefaultUsername, DefaultPassword)
+	if err != nil || u.Role != models.RoleOwner {
+		t.Fatalf("expected default owner to authenticate, got %+v, %v", u, err)
+	}
+
+	if err := db.AddUser(ctx, models.User{Username: "sam", Role: models.RoleViewer}, "sam-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUser(ctx, models.User{Username: "sam", Role: models.RoleViewer}, "other"); !errors.Is(err, database.ErrUserExists) {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+	if err := db.SetUserPassword(ctx, "sam", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AuthenticateUser(ctx, "sam", "sam-password"); !errors.Is(err, database.ErrInvalidCredentials) {
+		t.Errorf("expected old password to be rejected, got %v", err)
+	}
+	if _, err := db.AuthenticateUser(ctx, "sam", "new-password"); err != nil {
+		t.Errorf("expected new password to authenticate, got %v", err)
+	}
+
+	if err := db.DeleteUser(ctx, DefaultUsername); !errors.Is(err, database.ErrLastOwner) {
+		t.Errorf("expected deleting the last owner to fail, got %v", err)
+	}
+	if err := db.SetUserRole(ctx, "sam", models.RoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetUserRole(ctx, DefaultUsername, models.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := db.GetUser(ctx, DefaultUsername); u.Role != models.RoleViewer {
+		t.Errorf("expected %s to be a viewer, got %q", DefaultUsername, u.Role)
+	}
+	if _, err := db.GetUser(ctx, "nobody"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestProfileAndBanner(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	if err := db.UpdateProfile(ctx, models.Profile{Name: "Updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := db.GetProfile(ctx); p.Name != "Updated" {
+		t.Errorf("expected updated profile, got %+v", p)
+	}
+
+	banner := models.Banner{Enabled: true, Text: "Rally", Link: "https://example.com", Type: "urgent"}
+	if err := db.UpdateBanner(ctx, banner); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := db.GetBanner(ctx); b != banner {
+		t.Errorf("expected %+v, got %+v", banner, b)
+	}
+}
+
+func TestReplaceContent(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "stale"})
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "Old"})
+	_ = db.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "old"})
+
+	err := db.ReplaceContent(ctx, models.Content{
+		Profile:          models.Profile{Name: "Imported"},
+		Links:            []models.Link{{ID: "b"}, {ID: "a", Title: "New"}},
+		Banner:           models.Banner{Enabled: true, Type: "success"},
+		ScheduledBanners: []models.ScheduledBanner{{ID: "new"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := linkIDs(t, db); !equal(got, []string{"b", "a"}) {
+		t.Errorf("expected links b, a, got %v", got)
+	}
+	if p, _ := db.GetProfile(ctx); p.Name != "Imported" {
+		t.Errorf("expected profile to be replaced, got %+v", p)
+	}
+	if b, _ := db.GetBanner(ctx); !b.Enabled {
+		t.Errorf("expected banner to be replaced, got %+v", b)
+	}
+	if banners, _ := db.GetScheduledBanners(ctx); len(banners) != 1 || banners[0].ID != "new" {
+		t.Errorf("expected scheduled banners to be replaced, got %+v", banners)
+	}
+
+	// Without a banner queue the existing one is kept
+	if err := db.ReplaceContent(ctx, models.Content{}); err != nil {
+		t.Fatal(err)
+	}
+	if banners, _ := db.GetScheduledBanners(ctx); len(banners) != 1 {
+		t.Errorf("expected scheduled banners to be kept, got %+v", banners)
+	}
+}
+
+func TestAddLinksIsAtomic(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "taken"})
+
+	if err := db.AddLinks(ctx, []models.Link{{ID: "new"}, {ID: "taken"}}); err == nil {
+		t.Fatal("expected duplicate ID to fail the batch")
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"taken"}) {
+		t.Errorf("expected no links from the failed batch, got %v", got)
+	}
+}
+
+func TestClicks(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "a"})
+	_ = db.RecordClick(ctx, "a")
+	_ = db.RecordClick(ctx, "a")
+	if err := db.RecordClick(ctx, "missing"); !errors.Is(err, database.ErrLinkNotFound) {
+		t.Errorf("expected ErrLinkNotFound, got %v", err)
+	}
+
+	counts, _ := db.GetClickCounts(ctx)
+	if counts["a"] != 2 {
+		t.Errorf("expected 2 clicks, got %v", counts)
+	}
+
+	_ = db.DeleteLink(ctx, "a")
+	if counts, _ := db.GetClickCounts(ctx); len(counts) != 0 {
+		t.Errorf("expected counters to be removed with the link, got %v", counts)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.IncrementAnalytics(ctx, []models.AnalyticsCount{
+		{Day: "2026-01-01", Kind: models.AnalyticsView, Count: 3},
+		{Day: "2026-02-01", Kind: models.AnalyticsView, Referrer: "t.co", Count: 2},
+		{Day: "2026-02-01", Kind: models.AnalyticsClick, Referrer: "t.co", Count: 1},
+	})
+
+	rows, _ := db.GetAnalytics(ctx, "2026-01-01")
+	if len(rows) != 2 || rows[1] != (models.AnalyticsRow{Day: "2026-02-01", Referrer: "t.co", Views: 2, Clicks: 1}) {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+
+	_ = db.PruneAnalytics(ctx, "2026-02-01")
+	if rows, _ := db.GetAnalytics(ctx, "2000-01-01"); len(rows) != 1 {
+		t.Errorf("expected old counters to be pruned, got %+v", rows)
+	}
+
+	_ = db.AddLink(ctx, models.Link{ID: "a"})
+	_ = db.RecordClick(ctx, "a")
+	_ = db.PruneAnalytics(ctx, "9999-12-31")
+	if counts, _ := db.GetClickCounts(ctx); counts["a"] != 1 {
+		t.Errorf("expected link clicks to survive pruning, got %v", counts)
+	}
+}
+
+func TestScheduledBanners(t *testing.T) {
+	db := New()
+	ctx := context.Background()
+
+	_ = db.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "a", Text: "Rally"})
+	_ = db.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "b", Text: "Thanks"})
+	_ = db.DeleteScheduledBanner(ctx, "a")
+
+	banners, _ := db.GetScheduledBanners(ctx)
+	if len(banners) != 1 || banners[0].ID != "b" {
+		t.Errorf("expected only b to remain, got %+v", banners)
+	}
+}
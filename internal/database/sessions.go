@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func (d *database) CreateSession(ctx context.Context, hash string, s models.Session) error {
+	_, err := d.db.Exec(ctx, `INSERT INTO sessions (token_hash, username, created_at, last_seen_at, expires_at, user_agent, address, csrf_token, pending, attempts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		hash, s.Username, s.CreatedAt, s.LastSeenAt, s.ExpiresAt, s.UserAgent, s.Address, s.CSRFToken, s.Pending, s.Attempts)
+	return err
+}
+
+const sessionColumns = `token_hash, username, created_at, COALESCE(last_seen_at, created_at), expires_at, user_agent, address, csrf_token, pending, attempts`
+
+func scanSession(row pgx.Row) (models.Session, error) {
+	var s models.Session
+	err := row.Scan(&s.ID, &s.Username, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.UserAgent, &s.Address, &s.CSRFToken, &s.Pending, &s.Attempts)
+	return s, err
+}
+
+func (d *database) GetSession(ctx context.Context, hash string) (models.Session, error) {
+	s, err := scanSession(d.db.QueryRow(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE token_hash = $1`, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, ErrSessionNotFound
+	}
+	return s, err
+}
+
+// ListSessions returns signed-in sessions that are still valid at now, most
+// recently used first.
+func (d *database) ListSessions(ctx context.Context, now time.Time) ([]models.Session, error) {
+	rows, err := d.db.Query(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE NOT pending AND expires_at > $1
+		ORDER BY COALESCE(last_seen_at, created_at) DESC`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (d *database) UpdateSession(ctx context.Context, hash string, s models.Session) error {
+	tag, err := d.db.Exec(ctx, `UPDATE sessions SET last_seen_at = $1, expires_at = $2, csrf_token = $3, pending = $4, attempts = $5 WHERE token_hash = $6`,
+		s.LastSeenAt, s.ExpiresAt, s.CSRFToken, s.Pending, s.Attempts, hash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (d *database) DeleteSession(ctx context.Context, hash string) error {
+	_, err := d.db.Exec(ctx, `DELETE FROM sessions WHERE token_hash = $1`, hash)
+	return err
+}
+
+// DeleteUserSessions signs username out everywhere except the session
+// stored under keep, which may be empty.
+func (d *database) DeleteUserSessions(ctx context.Context, username, keep string) (int, error) {
+	tag, err := d.db.Exec(ctx, `DELETE FROM sessions WHERE username = $1 AND token_hash <> $2`, username, keep)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (d *database) DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	tag, err := d.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
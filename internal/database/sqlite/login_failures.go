@@ -0,0 +1,41 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func (d *sqliteDatabase) RecordLoginFailure(ctx context.Context, f models.LoginFailure) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO login_failures (username, address, user_agent, reason, created_at) VALUES (?, ?, ?, ?, ?)`,
+		f.Username, f.Address, f.UserAgent, f.Reason, f.At.UTC())
+	return err
+}
+
+func (d *sqliteDatabase) GetLoginFailures(ctx context.Context, limit int) ([]models.LoginFailure, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT username, address, user_agent, reason, created_at FROM login_failures ORDER BY created_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []models.LoginFailure
+	for rows.Next() {
+		var f models.LoginFailure
+		if err := rows.Scan(&f.Username, &f.Address, &f.UserAgent, &f.Reason, &f.At); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+func (d *sqliteDatabase) PruneLoginFailures(ctx context.Context, before time.Time) (int, error) {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM login_failures WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
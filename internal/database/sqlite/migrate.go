@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/alexraskin/standwithiran/migrations"
+)
+
+// Migrate applies pending migrations, each in its own transaction. SQLite
+// has a single writer, so no extra locking is needed between processes.
+func (d *sqliteDatabase) Migrate(ctx context.Context) error {
+	ms, err := migrations.SQLite()
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := d.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := d.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		slog.Info("Applied migration", slog.String("migration", m.Name))
+	}
+
+	return nil
+}
+
+func (d *sqliteDatabase) SchemaVersion(ctx context.Context) (int, int, error) {
+	ms, err := migrations.SQLite()
+	if err != nil {
+		return 0, 0, err
+	}
+	var applied int
+	if err := d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied); err != nil {
+		return 0, 0, err
+	}
+	return applied, migrations.Latest(ms), nil
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+// Session times are stored in UTC so expires_at compares correctly as text.
+
+func (d *sqliteDatabase) CreateSession(ctx context.Context, hash string, s models.Session) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO sessions (token_hash, username, created_at, last_seen_at, expires_at, user_agent, address, csrf_token, pending, attempts) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hash, s.Username, s.CreatedAt.UTC(), s.LastSeenAt.UTC(), s.ExpiresAt.UTC(), s.UserAgent, s.Address, s.CSRFToken, s.Pending, s.Attempts)
+	return err
+}
+
+const sessionColumns = `token_hash, username, created_at, last_seen_at, expires_at, user_agent, address, csrf_token, pending, attempts`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSession reads sessionColumns. Sessions from before last_seen_at was
+// added count as last seen when they were created.
+func scanSession(row scanner) (models.Session, error) {
+	var s models.Session
+	var lastSeen sql.NullTime
+	err := row.Scan(&s.ID, &s.Username, &s.CreatedAt, &lastSeen, &s.ExpiresAt, &s.UserAgent, &s.Address, &s.CSRFToken, &s.Pending, &s.Attempts)
+	s.LastSeenAt = s.CreatedAt
+	if lastSeen.Valid {
+		s.LastSeenAt = lastSeen.Time
+	}
+	return s, err
+}
+
+func (d *sqliteDatabase) GetSession(ctx context.Context, hash string) (models.Session, error) {
+	s, err := scanSession(d.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE token_hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, database.ErrSessionNotFound
+	}
+	return s, err
+}
+
+func (d *sqliteDatabase) ListSessions(ctx context.Context, now time.Time) ([]models.Session, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE NOT pending AND expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (d *sqliteDatabase) UpdateSession(ctx context.Context, hash string, s models.Session) error {
+	res, err := d.db.ExecContext(ctx, `UPDATE sessions SET last_seen_at = ?, expires_at = ?, csrf_token = ?, pending = ?, attempts = ? WHERE token_hash = ?`,
+		s.LastSeenAt.UTC(), s.ExpiresAt.UTC(), s.CSRFToken, s.Pending, s.Attempts, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (d *sqliteDatabase) DeleteSession(ctx context.Context, hash string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = ?`, hash)
+	return err
+}
+
+func (d *sqliteDatabase) DeleteUserSessions(ctx context.Context, username, keep string) (int, error) {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM sessions WHERE username = ? AND token_hash <> ?`, username, keep)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (d *sqliteDatabase) DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
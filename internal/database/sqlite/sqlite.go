@@ -0,0 +1,506 @@
+// Package sqlite implements database.Database on top of a single SQLite file,
+// for deployments that cannot run Postgres next to the app.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/alexraskin/standwithiran/internal/cache"
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+type sqliteDatabase struct {
+	db    *sql.DB
+	cache *cache.Cache
+}
+
+// New opens (or creates) the SQLite database at path. Call Migrate before
+// use to create the schema.
+func New(ctx context.Context, path string) (database.Database, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY and
+	// keeps ":memory:" databases from being split across connections.
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping sqlite database: %w", err)
+	}
+
+	return &sqliteDatabase{
+		db:    db,
+		cache: cache.NewCache(60 * time.Minute),
+	}, nil
+}
+
+func (d *sqliteDatabase) Close() {
+	_ = d.db.Close()
+}
+
+func (d *sqliteDatabase) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+func (d *sqliteDatabase) Stats() database.Stats {
+	return database.Stats{Cache: d.cache.Stats()}
+}
+
+func (d *sqliteDatabase) GetProfile(ctx context.Context) (models.Profile, error) {
+	if p, ok := d.cache.GetProfile(); ok {
+		return *p, nil
+	}
+
+	var p models.Profile
+	err := d.db.QueryRowContext(ctx, `SELECT name, title, subtitle, description, avatar FROM profile WHERE id = 1`).
+		Scan(&p.Name, &p.Title, &p.Subtitle, &p.Description, &p.Avatar)
+	if err != nil {
+		return p, err
+	}
+
+	d.cache.SetProfile(p)
+	return p, nil
+}
+
+func (d *sqliteDatabase) UpdateProfile(ctx context.Context, p models.Profile) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE profile SET name = ?, title = ?, subtitle = ?, description = ?, avatar = ? WHERE id = 1`,
+		p.Name, p.Title, p.Subtitle, p.Description, p.Avatar)
+	if err == nil {
+		d.cache.InvalidateProfile()
+	}
+	return err
+}
+
+func (d *sqliteDatabase) GetLinks(ctx context.Context) ([]models.Link, error) {
+	if links, ok := d.cache.GetLinks(); ok {
+		return links, nil
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT id, title, url, category, icon, featured, publish_at, expires_at FROM links ORDER BY featured DESC, sort_order, created_at DESC, rowid DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var links []models.Link
+	for rows.Next() {
+		var l models.Link
+		if err := rows.Scan(&l.ID, &l.Title, &l.URL, &l.Category, &l.Icon, &l.Featured, &l.PublishAt, &l.ExpiresAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	d.cache.SetLinks(links)
+	return links, nil
+}
+
+func (d *sqliteDatabase) AddLink(ctx context.Context, l models.Link) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO links (id, title, url, category, icon, featured, publish_at, expires_at, sort_order)
+			SELECT ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(MAX(sort_order), -1) + 1 FROM links`,
+		l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured, l.PublishAt, l.ExpiresAt)
+	if err == nil {
+		d.cache.InvalidateLinks()
+	}
+	return err
+}
+
+func (d *sqliteDatabase) AddLinks(ctx context.Context, links []models.Link) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, l := range links {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO links (id, title, url, category, icon, featured, publish_at, expires_at, sort_order)
+			SELECT ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(MAX(sort_order), -1) + 1 FROM links`,
+			l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured, l.PublishAt, l.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	d.cache.InvalidateLinks()
+	return nil
+}
+
+func (d *sqliteDatabase) UpdateLink(ctx context.Context, l models.Link) error {
+	res, err := d.db.ExecContext(ctx, `UPDATE links SET title = ?, url = ?, category = ?, icon = ?, featured = ?, publish_at = ?, expires_at = ? WHERE id = ?`,
+		l.Title, l.URL, l.Category, l.Icon, l.Featured, l.PublishAt, l.ExpiresAt, l.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrLinkNotFound
+	}
+	d.cache.InvalidateLinks()
+	return nil
+}
+
+func (d *sqliteDatabase) DeleteLink(ctx context.Context, id string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM links WHERE id = ?`, id)
+	if err == nil {
+		d.cache.InvalidateLinks()
+		d.cache.InvalidateLinkHealth()
+	}
+	return err
+}
+
+func (d *sqliteDatabase) UpdateLinkFeatured(ctx context.Context, id string, featured bool) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE links SET featured = ? WHERE id = ?`, featured, id)
+	if err == nil {
+		d.cache.InvalidateLinks()
+	}
+	return err
+}
+
+func (d *sqliteDatabase) ReorderLinks(ctx context.Context, ids []string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i, id := range ids {
+		res, err := tx.ExecContext(ctx, `UPDATE links SET sort_order = ? WHERE id = ?`, i, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return database.ErrLinkNotFound
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	d.cache.InvalidateLinks()
+	return nil
+}
+
+func (d *sqliteDatabase) GetBanner(ctx context.Context) (models.Banner, error) {
+	if b, ok := d.cache.GetBanner(); ok {
+		return *b, nil
+	}
+
+	var b models.Banner
+	var enabled string
+
+	rows, err := d.db.QueryContext(ctx, `SELECT key, value FROM settings WHERE key LIKE 'banner_%'`)
+	if err != nil {
+		return b, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return b, err
+		}
+		switch key {
+		case "banner_enabled":
+			enabled = value
+		case "banner_text":
+			b.Text = value
+		case "banner_link":
+			b.Link = value
+		case "banner_type":
+			b.Type = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return b, err
+	}
+
+	b.Enabled = enabled == "true"
+	d.cache.SetBanner(b)
+	return b, nil
+}
+
+// UpdateBanner writes every banner setting in one transaction, so a failure
+// leaves the previous banner intact.
+func (d *sqliteDatabase) UpdateBanner(ctx context.Context, b models.Banner) error {
+	defer d.cache.InvalidateBanner()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := writeBanner(ctx, tx, b); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeBanner(ctx context.Context, tx *sql.Tx, b models.Banner) error {
+	settings := []struct{ key, value string }{
+		{"banner_enabled", strconv.FormatBool(b.Enabled)},
+		{"banner_text", b.Text},
+		{"banner_link", b.Link},
+		{"banner_type", b.Type},
+	}
+	for _, s := range settings {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, s.key, s.value); err != nil {
+			return fmt.Errorf("failed to save %s: %w", s.key, err)
+		}
+	}
+	return nil
+}
+
+func (d *sqliteDatabase) ReplaceContent(ctx context.Context, c models.Content) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	p := c.Profile
+	if _, err := tx.ExecContext(ctx, `UPDATE profile SET name = ?, title = ?, subtitle = ?, description = ?, avatar = ? WHERE id = 1`,
+		p.Name, p.Title, p.Subtitle, p.Description, p.Avatar); err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(c.Links))
+	for _, l := range c.Links {
+		keep[l.ID] = true
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM links`)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range stale {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM links WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+
+	for i, l := range c.Links {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO links (id, title, url, category, icon, featured, sort_order, publish_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET title = excluded.title, url = excluded.url, category = excluded.category,
+			icon = excluded.icon, featured = excluded.featured, sort_order = excluded.sort_order,
+			publish_at = excluded.publish_at, expires_at = excluded.expires_at`,
+			l.ID, l.Title, l.URL, l.Category, l.Icon, l.Featured, i, l.PublishAt, l.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if err := writeBanner(ctx, tx, c.Banner); err != nil {
+		return err
+	}
+
+	if c.ScheduledBanners != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM banners`); err != nil {
+			return err
+		}
+		for _, b := range c.ScheduledBanners {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO banners (id, text, link, type, priority, starts_at, ends_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				b.ID, b.Text, b.Link, b.Type, b.Priority, b.StartsAt, b.EndsAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	d.cache.InvalidateProfile()
+	d.cache.InvalidateLinks()
+	d.cache.InvalidateBanner()
+	d.cache.InvalidateScheduledBanners()
+	d.cache.InvalidateLinkHealth()
+	return nil
+}
+
+func (d *sqliteDatabase) RecordClick(ctx context.Context, linkID string) error {
+	day := time.Now().UTC().Format(time.DateOnly)
+	_, err := d.db.ExecContext(ctx, `INSERT INTO link_clicks (link_id, day, count) VALUES (?, ?, 1)
+		ON CONFLICT (link_id, day) DO UPDATE SET count = count + 1`, linkID, day)
+	return err
+}
+
+func (d *sqliteDatabase) GetClickCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT link_id, SUM(count) FROM link_clicks GROUP BY link_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+func (d *sqliteDatabase) IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, c := range counts {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO analytics_daily (day, kind, referrer, count) VALUES (?, ?, ?, ?)
+			ON CONFLICT (day, kind, referrer) DO UPDATE SET count = count + excluded.count`,
+			c.Day, c.Kind, c.Referrer, c.Count); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *sqliteDatabase) GetAnalytics(ctx context.Context, since string) ([]models.AnalyticsRow, error) {
+	// The driver turns DATE columns into time.Time; the cast keeps the
+	// stored YYYY-MM-DD text.
+	rows, err := d.db.QueryContext(ctx, `SELECT CAST(day AS TEXT), referrer,
+			SUM(CASE WHEN kind = 'view' THEN count ELSE 0 END),
+			SUM(CASE WHEN kind = 'click' THEN count ELSE 0 END)
+		FROM analytics_daily WHERE day >= ?
+		GROUP BY day, referrer ORDER BY day, referrer`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []models.AnalyticsRow
+	for rows.Next() {
+		var r models.AnalyticsRow
+		if err := rows.Scan(&r.Day, &r.Referrer, &r.Views, &r.Clicks); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (d *sqliteDatabase) PruneAnalytics(ctx context.Context, before string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM analytics_daily WHERE day < ?`, before)
+	return err
+}
+
+func (d *sqliteDatabase) GetLinkHealth(ctx context.Context) (map[string]models.LinkHealth, error) {
+	if health, ok := d.cache.GetLinkHealth(); ok {
+		return health, nil
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT link_id, url, status_code, final_url, error, failures, checked_at FROM link_health`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	health := make(map[string]models.LinkHealth)
+	for rows.Next() {
+		var h models.LinkHealth
+		if err := rows.Scan(&h.LinkID, &h.URL, &h.StatusCode, &h.FinalURL, &h.Error, &h.Failures, &h.CheckedAt); err != nil {
+			return nil, err
+		}
+		health[h.LinkID] = h
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	d.cache.SetLinkHealth(health)
+	return health, nil
+}
+
+func (d *sqliteDatabase) UpdateLinkHealth(ctx context.Context, h models.LinkHealth) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO link_health (link_id, url, status_code, final_url, error, failures, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (link_id) DO UPDATE SET url = excluded.url, status_code = excluded.status_code,
+			final_url = excluded.final_url, error = excluded.error, failures = excluded.failures, checked_at = excluded.checked_at`,
+		h.LinkID, h.URL, h.StatusCode, h.FinalURL, h.Error, h.Failures, h.CheckedAt.UTC())
+	if err == nil {
+		d.cache.InvalidateLinkHealth()
+	}
+	return err
+}
+
+func (d *sqliteDatabase) GetScheduledBanners(ctx context.Context) ([]models.ScheduledBanner, error) {
+	if banners, ok := d.cache.GetScheduledBanners(); ok {
+		return banners, nil
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT id, text, link, type, priority, starts_at, ends_at FROM banners ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	banners := []models.ScheduledBanner{}
+	for rows.Next() {
+		var b models.ScheduledBanner
+		if err := rows.Scan(&b.ID, &b.Text, &b.Link, &b.Type, &b.Priority, &b.StartsAt, &b.EndsAt); err != nil {
+			return nil, err
+		}
+		banners = append(banners, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	d.cache.SetScheduledBanners(banners)
+	return banners, nil
+}
+
+func (d *sqliteDatabase) AddScheduledBanner(ctx context.Context, b models.ScheduledBanner) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO banners (id, text, link, type, priority, starts_at, ends_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		b.ID, b.Text, b.Link, b.Type, b.Priority, b.StartsAt, b.EndsAt)
+	if err == nil {
+		d.cache.InvalidateScheduledBanners()
+	}
+	return err
+}
+
+func (d *sqliteDatabase) DeleteScheduledBanner(ctx context.Context, id string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM banners WHERE id = ?`, id)
+	if err == nil {
+		d.cache.InvalidateScheduledBanners()
+	}
+	return err
+}
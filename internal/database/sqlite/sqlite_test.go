@@ -0,0 +1,675 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/migrations"
+)
+
+func newTestDatabase(t *testing.T) database.Database {
+	t.Helper()
+	db, err := New(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	return db
+}
+
+func linkIDs(t *testing.T, db database.Database) []string {
+	t.Helper()
+	links, err := db.GetLinks(context.Background())
+	if err != nil {
+		t.Fatalf("GetLinks failed: %v", err)
+	}
+	ids := make([]string, len(links))
+	for i, l := range links {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	p, err := db.GetProfile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Stand With Iran" {
+		t.Errorf("expected default profile name, got %q", p.Name)
+	}
+
+	b, err := db.GetBanner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Enabled || b.Type != "info" {
+		t.Errorf("expected disabled info banner, got %+v", b)
+	}
+}
+
+func TestMigrateRecordsVersions(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	ms, err := migrations.SQLite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count, latest int
+	err = db.(*sqliteDatabase).db.QueryRowContext(ctx, `SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&count, &latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(ms) || latest != migrations.Latest(ms) {
+		t.Errorf("expected %d migrations up to %d, got %d up to %d", len(ms), migrations.Latest(ms), count, latest)
+	}
+
+	applied, want, err := db.SchemaVersion(ctx)
+	if err != nil || applied != want || want != migrations.Latest(ms) {
+		t.Errorf("expected schema version %d of %d, got %d of %d, %v", migrations.Latest(ms), migrations.Latest(ms), applied, want, err)
+	}
+	if err := db.Ping(ctx); err != nil {
+		t.Errorf("unexpected ping error %v", err)
+	}
+}
+
+func TestReopenKeepsData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	ctx := context.Background()
+
+	db, err := New(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddLink(ctx, models.Link{ID: "a", Title: "Kept", URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Migrating again is a no-op and must not clobber existing rows
+	db, err = New(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := db.GetLinks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Title != "Kept" {
+		t.Errorf("expected link to survive reopen, got %+v", links)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	for _, l := range []models.Link{{ID: "a"}, {ID: "b"}, {ID: "c", Featured: true}} {
+		if err := db.AddLink(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("unexpected order %v", got)
+	}
+
+	if err := db.ReorderLinks(ctx, []string{"c", "b", "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "b", "a"}) {
+		t.Errorf("unexpected order after reorder %v", got)
+	}
+
+	if err := db.ReorderLinks(ctx, []string{"b", "missing", "a"}); !errors.Is(err, database.ErrLinkNotFound) {
+		t.Errorf("expected ErrLinkNotFound, got %v", err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "b", "a"}) {
+		t.Errorf("expected failed reorder to roll back, got %v", got)
+	}
+
+	// New links go after the reordered ones
+	if err := db.AddLink(ctx, models.Link{ID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddLinks(ctx, []models.Link{{ID: "e"}, {ID: "f"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"c", "b", "a", "d", "e", "f"}) {
+		t.Errorf("unexpected order after adding %v", got)
+	}
+	for _, id := range []string{"d", "e", "f"} {
+		_ = db.DeleteLink(ctx, id)
+	}
+
+	if err := db.UpdateLink(ctx, models.Link{ID: "a", Title: "Edited", URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateLink(ctx, models.Link{ID: "missing"}); !errors.Is(err, database.ErrLinkNotFound) {
+		t.Errorf("expected ErrLinkNotFound, got %v", err)
+	}
+
+	if err := db.UpdateLinkFeatured(ctx, "b", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteLink(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	links, _ := db.GetLinks(ctx)
+	if len(links) != 2 || links[0].ID != "b" || !links[0].Featured || links[1].Title != "Edited" {
+		t.Errorf("unexpected links %+v", links)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	// The migration moves the seeded plaintext password onto an admin
+	// owner, and it is upgraded to bcrypt on first login
+	u, err := db.AuthenticateUser(ctx, "admin", "changeme123")
+	if err != nil || u.Role != models.RoleOwner {
+		t.Fatalf("expected seeded admin owner to authenticate, got %+v, %v", u, err)
+	}
+	if _, err := db.AuthenticateUser(ctx, "admin", "changeme123"); err != nil {
+		t.Errorf("expected upgraded password to authenticate, got %v", err)
+	}
+
+	if err := db.AddUser(ctx, models.User{Username: "sam", Role: models.RoleEditor}, "sam-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUser(ctx, models.User{Username: "sam", Role: models.RoleViewer}, "other"); !errors.Is(err, database.ErrUserExists) {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+	if _, err := db.AuthenticateUser(ctx, "sam", "wrong"); !errors.Is(err, database.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+	if _, err := db.AuthenticateUser(ctx, "nobody", "sam-password"); !errors.Is(err, database.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for an unknown user, got %v", err)
+	}
+
+	if err := db.SetUserPassword(ctx, "sam", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AuthenticateUser(ctx, "sam", "sam-password"); err == nil {
+		t.Error("expected old password to be rejected")
+	}
+	if err := db.SetUserPassword(ctx, "nobody", "new-password"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := db.SetUserRole(ctx, "admin", models.RoleEditor); !errors.Is(err, database.ErrLastOwner) {
+		t.Errorf("expected demoting the last owner to fail, got %v", err)
+	}
+	if err := db.DeleteUser(ctx, "admin"); !errors.Is(err, database.ErrLastOwner) {
+		t.Errorf("expected deleting the last owner to fail, got %v", err)
+	}
+	if err := db.SetUserRole(ctx, "sam", models.RoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteUser(ctx, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := db.GetUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "sam" || users[0].Role != models.RoleOwner {
+		t.Errorf("unexpected users %+v", users)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	if err := db.EnableTOTP(ctx, "admin", "SECRET", 100, []string{"h1", "h2"}); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := db.GetUser(ctx, "admin"); !u.TwoFactor {
+		t.Error("expected TwoFactor to be set")
+	}
+	if secret, _ := db.GetTOTPSecret(ctx, "admin"); secret != "SECRET" {
+		t.Errorf("expected stored secret, got %q", secret)
+	}
+
+	if ok, _ := db.UseTOTPStep(ctx, "admin", 100); ok {
+		t.Error("expected the enrollment step to be spent")
+	}
+	if ok, _ := db.UseTOTPStep(ctx, "admin", 101); !ok {
+		t.Error("expected a later step to be accepted")
+	}
+
+	if ok, _ := db.UseRecoveryCode(ctx, "admin", "h1"); !ok {
+		t.Error("expected recovery code to be accepted")
+	}
+	if ok, _ := db.UseRecoveryCode(ctx, "admin", "h1"); ok {
+		t.Error("expected recovery code to be single-use")
+	}
+	if n, _ := db.CountRecoveryCodes(ctx, "admin"); n != 1 {
+		t.Errorf("expected 1 recovery code left, got %d", n)
+	}
+
+	if err := db.DisableTOTP(ctx, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := db.GetUser(ctx, "admin"); u.TwoFactor {
+		t.Error("expected TwoFactor to be cleared")
+	}
+	if n, _ := db.CountRecoveryCodes(ctx, "admin"); n != 0 {
+		t.Errorf("expected recovery codes to be removed, got %d", n)
+	}
+	if err := db.DisableTOTP(ctx, "nobody"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	if err := db.AddUser(ctx, models.User{Username: "sam", Role: models.RoleEditor}, "secret-pw"); err != nil {
+		t.Fatal(err)
+	}
+	sess := models.Session{Username: "sam", CreatedAt: now, ExpiresAt: now.Add(time.Hour), Pending: true}
+	if err := db.CreateSession(ctx, "h1", sess); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateSession(ctx, "old", models.Session{Username: "admin", CreatedAt: now, ExpiresAt: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetSession(ctx, "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "sam" || !got.Pending || !got.ExpiresAt.Equal(sess.ExpiresAt) {
+		t.Errorf("unexpected session %+v", got)
+	}
+
+	sess.Pending, sess.Attempts = false, 2
+	if err := db.UpdateSession(ctx, "h1", sess); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.GetSession(ctx, "h1"); got.Pending || got.Attempts != 2 {
+		t.Errorf("expected update to be stored, got %+v", got)
+	}
+	if err := db.UpdateSession(ctx, "missing", sess); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := db.CreateSession(ctx, "h2", models.Session{Username: "sam", CreatedAt: now, LastSeenAt: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour), UserAgent: "Firefox", Address: "203.0.113.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := db.ListSessions(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "h2" || list[0].UserAgent != "Firefox" || list[0].Address != "203.0.113.0/24" {
+		t.Errorf("expected live sessions most recent first, got %+v", list)
+	}
+	if n, err := db.DeleteUserSessions(ctx, "sam", "h1"); err != nil || n != 1 {
+		t.Errorf("expected 1 other session removed, got %d, %v", n, err)
+	}
+
+	if n, err := db.DeleteExpiredSessions(ctx, now); err != nil || n != 1 {
+		t.Errorf("expected 1 expired session removed, got %d, %v", n, err)
+	}
+	if _, err := db.GetSession(ctx, "old"); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Errorf("expected expired session to be gone, got %v", err)
+	}
+
+	if err := db.DeleteUser(ctx, "sam"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetSession(ctx, "h1"); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Errorf("expected sessions to go with their user, got %v", err)
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	for i, name := range []string{"old", "admin", "nobody"} {
+		f := models.LoginFailure{Username: name, Address: "203.0.113.7", Reason: models.LoginFailurePassword, At: now.Add(time.Duration(i) * time.Hour)}
+		if err := db.RecordLoginFailure(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failures, err := db.GetLoginFailures(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 2 || failures[0].Username != "nobody" || failures[1].Username != "admin" || !failures[0].At.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("expected the 2 newest failures, got %+v", failures)
+	}
+
+	if n, err := db.PruneLoginFailures(ctx, now.Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("expected 1 failure pruned, got %d, %v", n, err)
+	}
+}
+
+func TestProfileAndBanner(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	if err := db.UpdateProfile(ctx, models.Profile{Name: "Updated", Avatar: "https://example.com/a.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := db.GetProfile(ctx); p.Name != "Updated" {
+		t.Errorf("expected updated profile, got %+v", p)
+	}
+
+	banner := models.Banner{Enabled: true, Text: "Rally", Link: "https://example.com", Type: "urgent"}
+	if err := db.UpdateBanner(ctx, banner); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := db.GetBanner(ctx); b != banner {
+		t.Errorf("expected %+v, got %+v", banner, b)
+	}
+}
+
+func TestReplaceContent(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "stale", Title: "Stale", URL: "https://stale"})
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "Old A", URL: "https://a"})
+	_ = db.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "old", Text: "Old", Type: "info"})
+
+	err := db.ReplaceContent(ctx, models.Content{
+		Profile: models.Profile{Name: "Imported"},
+		Links: []models.Link{
+			{ID: "b", Title: "B", URL: "https://b"},
+			{ID: "a", Title: "A", URL: "https://a"},
+		},
+		Banner:           models.Banner{Enabled: true, Text: "Imported", Type: "success"},
+		ScheduledBanners: []models.ScheduledBanner{{ID: "new", Text: "Rally", Type: "urgent", Priority: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := linkIDs(t, db); !equal(got, []string{"b", "a"}) {
+		t.Errorf("expected links b, a, got %v", got)
+	}
+	links, _ := db.GetLinks(ctx)
+	if links[1].Title != "A" {
+		t.Errorf("expected existing link to be updated, got %+v", links[1])
+	}
+	if p, _ := db.GetProfile(ctx); p.Name != "Imported" {
+		t.Errorf("expected profile to be replaced, got %+v", p)
+	}
+	if b, _ := db.GetBanner(ctx); !b.Enabled || b.Text != "Imported" {
+		t.Errorf("expected banner to be replaced, got %+v", b)
+	}
+	if banners, _ := db.GetScheduledBanners(ctx); len(banners) != 1 || banners[0].ID != "new" || banners[0].Priority != 2 {
+		t.Errorf("expected scheduled banners to be replaced, got %+v", banners)
+	}
+
+	// Without a banner queue the existing one is kept
+	if err := db.ReplaceContent(ctx, models.Content{}); err != nil {
+		t.Fatal(err)
+	}
+	if banners, _ := db.GetScheduledBanners(ctx); len(banners) != 1 {
+		t.Errorf("expected scheduled banners to be kept, got %+v", banners)
+	}
+}
+
+func TestAddLinksIsAtomic(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "taken", Title: "Taken", URL: "https://taken"})
+
+	err := db.AddLinks(ctx, []models.Link{
+		{ID: "new", Title: "New", URL: "https://new"},
+		{ID: "taken", Title: "Clash", URL: "https://clash"},
+	})
+	if err == nil {
+		t.Fatal("expected duplicate ID to fail the batch")
+	}
+	if got := linkIDs(t, db); !equal(got, []string{"taken"}) {
+		t.Errorf("expected no links from the failed batch, got %v", got)
+	}
+
+	if err := db.AddLinks(ctx, []models.Link{{ID: "a", Title: "A", URL: "https://a"}, {ID: "b", Title: "B", URL: "https://b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkIDs(t, db); len(got) != 3 {
+		t.Errorf("expected 3 links, got %v", got)
+	}
+}
+
+func TestClicks(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "A", URL: "https://a"})
+	_ = db.AddLink(ctx, models.Link{ID: "b", Title: "B", URL: "https://b"})
+
+	for _, id := range []string{"a", "a", "b"} {
+		if err := db.RecordClick(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.RecordClick(ctx, "missing"); err == nil {
+		t.Error("expected click on unknown link to fail")
+	}
+
+	counts, err := db.GetClickCounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["a"] != 2 || counts["b"] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+
+	// Deleting a link removes its counters
+	_ = db.DeleteLink(ctx, "a")
+	counts, _ = db.GetClickCounts(ctx)
+	if _, ok := counts["a"]; ok {
+		t.Errorf("expected counters to be removed with the link, got %v", counts)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	counts := []models.AnalyticsCount{
+		{Day: "2026-01-01", Kind: models.AnalyticsView, Referrer: "t.co", Count: 3},
+		{Day: "2026-02-01", Kind: models.AnalyticsView, Referrer: "t.co", Count: 2},
+		{Day: "2026-02-01", Kind: models.AnalyticsClick, Referrer: "t.co", Count: 1},
+	}
+	for range 2 {
+		if err := db.IncrementAnalytics(ctx, counts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := db.GetAnalytics(ctx, "2026-02-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.AnalyticsRow{Day: "2026-02-01", Referrer: "t.co", Views: 4, Clicks: 2}
+	if len(rows) != 1 || rows[0] != want {
+		t.Errorf("expected %+v, got %+v", want, rows)
+	}
+
+	if err := db.PruneAnalytics(ctx, "2026-02-01"); err != nil {
+		t.Fatal(err)
+	}
+	rows, _ = db.GetAnalytics(ctx, "2000-01-01")
+	if len(rows) != 1 || rows[0].Day != "2026-02-01" {
+		t.Errorf("expected only the newer day to survive pruning, got %+v", rows)
+	}
+
+	// Per-link click totals are lifetime counts
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "A", URL: "https://a"})
+	_ = db.RecordClick(ctx, "a")
+	if err := db.PruneAnalytics(ctx, "9999-12-31"); err != nil {
+		t.Fatal(err)
+	}
+	if counts, _ := db.GetClickCounts(ctx); counts["a"] != 1 {
+		t.Errorf("expected link clicks to survive pruning, got %v", counts)
+	}
+}
+
+func TestLinkHealth(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "A", URL: "https://a"})
+	checkedAt := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	h := models.LinkHealth{LinkID: "a", URL: "https://a", StatusCode: 404, Failures: 2, CheckedAt: checkedAt}
+	if err := db.UpdateLinkHealth(ctx, h); err != nil {
+		t.Fatal(err)
+	}
+
+	health, err := db.GetLinkHealth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := health["a"]
+	if got.StatusCode != 404 || got.Failures != 2 || !got.CheckedAt.Equal(checkedAt) {
+		t.Errorf("unexpected health %+v", got)
+	}
+
+	// Results go away with the link
+	_ = db.DeleteLink(ctx, "a")
+	if err := db.UpdateLinkHealth(ctx, h); err == nil {
+		t.Error("expected health for a deleted link to be rejected")
+	}
+	if health, _ := db.GetLinkHealth(ctx); len(health) != 0 {
+		t.Errorf("expected no health rows, got %v", health)
+	}
+}
+
+func TestLinkSchedule(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	publish := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	expires := time.Date(2026, 3, 8, 18, 0, 0, 0, time.UTC)
+	_ = db.AddLink(ctx, models.Link{ID: "a", Title: "A", URL: "https://a", PublishAt: &publish, ExpiresAt: &expires})
+	_ = db.AddLink(ctx, models.Link{ID: "b", Title: "B", URL: "https://b"})
+
+	links, err := db.GetLinks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]models.Link{}
+	for _, l := range links {
+		byID[l.ID] = l
+	}
+	a := byID["a"]
+	if a.PublishAt == nil || !a.PublishAt.Equal(publish) || a.ExpiresAt == nil || !a.ExpiresAt.Equal(expires) {
+		t.Errorf("unexpected schedule %v - %v", a.PublishAt, a.ExpiresAt)
+	}
+	if byID["b"].PublishAt != nil || byID["b"].ExpiresAt != nil {
+		t.Errorf("expected no schedule, got %+v", byID["b"])
+	}
+
+	// Clearing the schedule stores NULLs
+	a.PublishAt, a.ExpiresAt = nil, nil
+	_ = db.UpdateLink(ctx, a)
+	links, _ = db.GetLinks(ctx)
+	for _, l := range links {
+		if l.ID == "a" && (l.PublishAt != nil || l.ExpiresAt != nil) {
+			t.Errorf("expected schedule to be cleared, got %+v", l)
+		}
+	}
+}
+
+func TestScheduledBanners(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	starts := time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC)
+	if err := db.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "a", Text: "Rally", Type: "urgent", Priority: 2, StartsAt: &starts}); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.AddScheduledBanner(ctx, models.ScheduledBanner{ID: "b", Text: "Thanks", Type: "success"})
+
+	banners, err := db.GetScheduledBanners(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banners) != 2 || banners[0].ID != "a" || banners[0].Priority != 2 || !banners[0].StartsAt.Equal(starts) || banners[0].EndsAt != nil {
+		t.Errorf("unexpected banners %+v", banners)
+	}
+
+	_ = db.DeleteScheduledBanner(ctx, "a")
+	if banners, _ := db.GetScheduledBanners(ctx); len(banners) != 1 || banners[0].ID != "b" {
+		t.Errorf("expected only b to remain, got %+v", banners)
+	}
+}
+
+func TestUpdateBannerIsAtomic(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	before := models.Banner{Enabled: true, Text: "Old", Link: "https://old.example", Type: "info"}
+	if err := db.UpdateBanner(ctx, before); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail the third of the four writes
+	raw := db.(*sqliteDatabase).db
+	if _, err := raw.ExecContext(ctx, `CREATE TRIGGER fail_banner_link BEFORE UPDATE ON settings
+		WHEN NEW.key = 'banner_link' BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.UpdateBanner(ctx, models.Banner{Enabled: false, Text: "New", Link: "https://new.example", Type: "urgent"})
+	if err == nil {
+		t.Fatal("expected the injected error")
+	}
+
+	got, err := db.GetBanner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != before {
+		t.Errorf("expected the banner to be unchanged, got %+v", got)
+	}
+}
@@ -0,0 +1,212 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func (d *sqliteDatabase) AuthenticateUser(ctx context.Context, username, password string) (models.User, error) {
+	var u models.User
+	var hash string
+	err := d.db.QueryRowContext(ctx, `SELECT username, role, created_at, totp_secret <> '', password_hash FROM users WHERE username = ?`, username).
+		Scan(&u.Username, &u.Role, &u.CreatedAt, &u.TwoFactor, &hash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	ok, rehash := database.CheckPassword(hash, password)
+	if !ok {
+		return models.User{}, database.ErrInvalidCredentials
+	}
+	if rehash {
+		_ = d.SetUserPassword(ctx, username, password)
+	}
+	return u, nil
+}
+
+func (d *sqliteDatabase) GetUser(ctx context.Context, username string) (models.User, error) {
+	var u models.User
+	err := d.db.QueryRowContext(ctx, `SELECT username, role, created_at, totp_secret <> '' FROM users WHERE username = ?`, username).
+		Scan(&u.Username, &u.Role, &u.CreatedAt, &u.TwoFactor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, database.ErrUserNotFound
+	}
+	return u, err
+}
+
+func (d *sqliteDatabase) GetUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT username, role, created_at, totp_secret <> '' FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.Username, &u.Role, &u.CreatedAt, &u.TwoFactor); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (d *sqliteDatabase) AddUser(ctx context.Context, u models.User, password string) error {
+	hash, err := database.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	res, err := d.db.ExecContext(ctx, `INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?) ON CONFLICT (username) DO NOTHING`,
+		u.Username, hash, u.Role)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrUserExists
+	}
+	return nil
+}
+
+func (d *sqliteDatabase) SetUserPassword(ctx context.Context, username, password string) error {
+	hash, err := database.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	res, err := d.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE username = ?`, hash, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *sqliteDatabase) SetUserRole(ctx context.Context, username, role string) error {
+	return d.changeUser(ctx, username, role != models.RoleOwner, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE users SET role = ? WHERE username = ?`, role, username)
+		return err
+	})
+}
+
+func (d *sqliteDatabase) DeleteUser(ctx context.Context, username string) error {
+	return d.changeUser(ctx, username, true, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM users WHERE username = ?`, username)
+		return err
+	})
+}
+
+// changeUser runs change in a transaction after checking that username
+// exists and, if the change removes its owner role, that another owner is
+// left.
+func (d *sqliteDatabase) changeUser(ctx context.Context, username string, dropsOwner bool, change func(*sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var role string
+	var owners int
+	err = tx.QueryRowContext(ctx, `SELECT role, (SELECT COUNT(*) FROM users WHERE role = 'owner') FROM users WHERE username = ?`, username).
+		Scan(&role, &owners)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if dropsOwner && role == models.RoleOwner && owners <= 1 {
+		return database.ErrLastOwner
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *sqliteDatabase) GetTOTPSecret(ctx context.Context, username string) (string, error) {
+	var secret string
+	err := d.db.QueryRowContext(ctx, `SELECT totp_secret FROM users WHERE username = ?`, username).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", database.ErrUserNotFound
+	}
+	return secret, err
+}
+
+func (d *sqliteDatabase) EnableTOTP(ctx context.Context, username, secret string, step int64, recoveryHashes []string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET totp_secret = ?, totp_counter = ? WHERE username = ?`, secret, step, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = ?`, username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (username, code_hash) VALUES (?, ?)`, username, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *sqliteDatabase) DisableTOTP(ctx context.Context, username string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET totp_secret = '', totp_counter = 0 WHERE username = ?`, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = ?`, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *sqliteDatabase) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	res, err := d.db.ExecContext(ctx, `UPDATE users SET totp_counter = ? WHERE username = ? AND totp_counter < ?`, step, username, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (d *sqliteDatabase) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = ? AND code_hash = ?`, username, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (d *sqliteDatabase) CountRecoveryCodes(ctx context.Context, username string) (int, error) {
+	var n int
+	err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE username = ?`, username).Scan(&n)
+	return n, err
+}
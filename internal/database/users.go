@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLastOwner          = errors.New("at least one owner is required")
+)
+
+// dummyHash is compared against when a username does not exist, so a
+// failed login takes as long whether or not the account is real.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword compares password with a stored hash. Accounts carried over
+// from the shared admin password may still hold the plain-text seed; those
+// match literally and report rehash so the caller can store a real hash.
+func CheckPassword(hash, password string) (ok, rehash bool) {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false, false
+	}
+	if len(hash) < 60 {
+		return password == hash, password == hash
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, false
+}
+
+func (d *database) AuthenticateUser(ctx context.Context, username, password string) (models.User, error) {
+	var u models.User
+	var hash string
+	err := d.db.QueryRow(ctx, `SELECT username, role, created_at, totp_secret <> '', password_hash FROM users WHERE username = $1`, username).
+		Scan(&u.Username, &u.Role, &u.CreatedAt, &u.TwoFactor, &hash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	ok, rehash := CheckPassword(hash, password)
+	if !ok {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if rehash {
+		_ = d.SetUserPassword(ctx, username, password)
+	}
+	return u, nil
+}
+
+func (d *database) GetUser(ctx context.Context, username string) (models.User, error) {
+	var u models.User
+	err := d.db.QueryRow(ctx, `SELECT username, role, created_at, totp_secret <> '' FROM users WHERE username = $1`, username).
+		Scan(&u.Username, &u.Role, &u.CreatedAt, &u.TwoFactor)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+func (d *database) GetUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := d.db.Query(ctx, `SELECT username, role, created_at, totp_secret <> '' FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.Username, &u.Role, &u.CreatedAt, &u.TwoFactor); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (d *database) AddUser(ctx context.Context, u models.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tag, err := d.db.Exec(ctx, `INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) ON CONFLICT (username) DO NOTHING`,
+		u.Username, hash, u.Role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+func (d *database) SetUserPassword(ctx context.Context, username, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tag, err := d.db.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE username = $2`, hash, username)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetUserRole changes a user's role, refusing to demote the last owner.
+func (d *database) SetUserRole(ctx context.Context, username, role string) error {
+	return d.changeUser(ctx, username, role != models.RoleOwner, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `UPDATE users SET role = $1 WHERE username = $2`, role, username)
+		return err
+	})
+}
+
+// DeleteUser removes a user, refusing to remove the last owner.
+func (d *database) DeleteUser(ctx context.Context, username string) error {
+	return d.changeUser(ctx, username, true, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `DELETE FROM users WHERE username = $1`, username)
+		return err
+	})
+}
+
+// changeUser runs change in a transaction after checking that username
+// exists and, if the change removes its owner role, that another owner is
+// left. The owner rows are locked so concurrent demotions cannot race.
+func (d *database) changeUser(ctx context.Context, username string, dropsOwner bool, change func(pgx.Tx) error) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, `SELECT username FROM users WHERE role = 'owner' FOR UPDATE`)
+	if err != nil {
+		return err
+	}
+	owners, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	var role string
+	if err := tx.QueryRow(ctx, `SELECT role FROM users WHERE username = $1`, username).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if dropsOwner && role == models.RoleOwner && len(owners) <= 1 {
+		return ErrLastOwner
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *database) GetTOTPSecret(ctx context.Context, username string) (string, error) {
+	var secret string
+	err := d.db.QueryRow(ctx, `SELECT totp_secret FROM users WHERE username = $1`, username).Scan(&secret)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	return secret, err
+}
+
+// EnableTOTP stores a verified secret and replaces the user's recovery
+// codes. step is the time step of the code used to confirm enrollment.
+func (d *database) EnableTOTP(ctx context.Context, username, secret string, step int64, recoveryHashes []string) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET totp_secret = $1, totp_counter = $2 WHERE username = $3`, secret, step, username)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE username = $1`, username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO recovery_codes (username, code_hash) VALUES ($1, $2)`, username, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *database) DisableTOTP(ctx context.Context, username string) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET totp_secret = '', totp_counter = 0 WHERE username = $1`, username)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE username = $1`, username); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep records step as the user's last accepted code. It reports
+// false if a code from this or a later step was already used.
+func (d *database) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	tag, err := d.db.Exec(ctx, `UPDATE users SET totp_counter = $1 WHERE username = $2 AND totp_counter < $1`, step, username)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode deletes a recovery code, reporting whether it existed.
+func (d *database) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	tag, err := d.db.Exec(ctx, `DELETE FROM recovery_codes WHERE username = $1 AND code_hash = $2`, username, hash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (d *database) CountRecoveryCodes(ctx context.Context, username string) (int, error) {
+	var n int
+	err := d.db.QueryRow(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE username = $1`, username).Scan(&n)
+	return n, err
+}
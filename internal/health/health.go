@@ -0,0 +1,114 @@
+// Package health runs the named dependency checks behind the readiness
+// endpoint.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timeout bounds each check, so one hung dependency can't stall the probe.
+const Timeout = 2 * time.Second
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+	// StatusDraining is reported instead of running the checks once the
+	// server has begun shutting down.
+	StatusDraining = "draining"
+)
+
+// Check returns nil when the dependency it covers is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the checks that must pass for the server to take traffic.
+type Registry struct {
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add registers check under name. Adding a name again replaces the earlier
+// check.
+func (r *Registry) Add(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.checks {
+		if c.name == name {
+			r.checks[i].check = check
+			return
+		}
+	}
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Run runs every check concurrently and reports them in the order they
+// were added.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := append([]namedCheck(nil), r.checks...)
+	r.mu.Unlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, c namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	result := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
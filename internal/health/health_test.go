@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistryRun(t *testing.T) {
+	r := NewRegistry()
+	r.Add("database", func(ctx context.Context) error { return nil })
+	r.Add("migrations", func(ctx context.Context) error { return errors.New("2 pending") })
+	r.Add("slow", func(ctx context.Context) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	report := r.Run(context.Background())
+	if report.OK() || report.Status != StatusFail {
+		t.Errorf("expected the report to fail, got %+v", report)
+	}
+	if len(report.Checks) != 3 {
+		t.Fatalf("expected 3 results, got %+v", report.Checks)
+	}
+
+	db, migrations, slow := report.Checks[0], report.Checks[1], report.Checks[2]
+	if db.Name != "database" || db.Status != StatusOK || db.Error != "" {
+		t.Errorf("unexpected database result %+v", db)
+	}
+	if migrations.Name != "migrations" || migrations.Status != StatusFail || migrations.Error != "2 pending" {
+		t.Errorf("unexpected migrations result %+v", migrations)
+	}
+	if slow.LatencyMS < 5 {
+		t.Errorf("expected the slow check's latency to be measured, got %v", slow.LatencyMS)
+	}
+}
+
+func TestRegistryReplacesAndPasses(t *testing.T) {
+	r := NewRegistry()
+	if report := r.Run(context.Background()); !report.OK() || len(report.Checks) != 0 {
+		t.Errorf("expected an empty registry to pass, got %+v", report)
+	}
+
+	r.Add("database", func(ctx context.Context) error { return errors.New("down") })
+	r.Add("database", func(ctx context.Context) error { return nil })
+	if report := r.Run(context.Background()); !report.OK() || len(report.Checks) != 1 {
+		t.Errorf("expected the replaced check to pass, got %+v", report)
+	}
+}
+
+func TestRunTimesOutHungChecks(t *testing.T) {
+	r := NewRegistry()
+	r.Add("hung", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	report := r.Run(ctx)
+	if report.OK() || report.Checks[0].Error == "" {
+		t.Errorf("expected the hung check to fail, got %+v", report)
+	}
+}
@@ -0,0 +1,149 @@
+// Package linkcheck probes link URLs to find pages that have been taken down.
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/urlpolicy"
+)
+
+const (
+	userAgent = "Mozilla/5.0 (compatible; standwithiran-linkcheck/1.0; +https://standwithiran.com)"
+	// maxRedirects matches the limit net/http applies by default.
+	maxRedirects = 10
+)
+
+var errTooManyRedirects = errors.New("stopped after 10 redirects")
+
+type Result struct {
+	URL        string
+	StatusCode int
+	FinalURL   string
+	Err        error
+	// Skipped is set for links that can't be checked over HTTP, such as
+	// mailto: and tel: links. They are neither working nor broken.
+	Skipped bool
+}
+
+// OK reports whether the link answered with a non-error status.
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode > 0 && r.StatusCode < 400
+}
+
+type Checker struct {
+	client *http.Client
+}
+
+// NewChecker returns a Checker that only connects to public addresses, so a
+// link that redirects to (or resolves to) a private or local network can't
+// make the server probe it.
+func NewChecker(timeout time.Duration) *Checker {
+	return newChecker(timeout, urlpolicy.Public)
+}
+
+// newChecker lets tests allow the loopback address their servers listen on.
+func newChecker(timeout time.Duration, allowed func(netip.Addr) bool) *Checker {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Control sees the address after DNS resolution, so a public name
+		// pointing at a private address is refused too
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !allowed(addrPort.Addr()) {
+				return fmt.Errorf("refusing to connect to %s: %w", addrPort.Addr(), urlpolicy.ErrPrivate)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// The address check has to see the link's own host, not a proxy's
+	transport.Proxy = nil
+
+	return &Checker{client: &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s: %w", req.URL.Scheme, urlpolicy.ErrScheme)
+			}
+			if addr, err := netip.ParseAddr(req.URL.Hostname()); err == nil && !allowed(addr) {
+				return fmt.Errorf("redirect to %s: %w", addr, urlpolicy.ErrPrivate)
+			}
+			return nil
+		},
+	}}
+}
+
+// Check issues a HEAD request and falls back to GET for servers that do not
+// implement HEAD properly. Links that aren't http or https are skipped.
+func (c *Checker) Check(ctx context.Context, rawURL string) Result {
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme != "http" && u.Scheme != "https" {
+		return Result{URL: rawURL, Skipped: true}
+	}
+
+	res := c.do(ctx, http.MethodHead, rawURL)
+	if res.Err != nil || res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented || res.StatusCode == http.StatusForbidden {
+		res = c.do(ctx, http.MethodGet, rawURL)
+	}
+	return res
+}
+
+func (c *Checker) do(ctx context.Context, method, url string) Result {
+	res := Result{URL: url}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	res.StatusCode = resp.StatusCode
+	res.FinalURL = resp.Request.URL.String()
+	return res
+}
+
+// CheckAll checks urls with at most concurrency requests in flight and
+// returns the results in the same order.
+func (c *Checker) CheckAll(ctx context.Context, urls []string, concurrency int) []Result {
+	results := make([]Result, len(urls))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = c.Check(ctx, url)
+		}()
+	}
+	wg.Wait()
+	return results
+}
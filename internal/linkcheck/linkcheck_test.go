@@ -0,0 +1,102 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/urlpolicy"
+)
+
+// allowLoopback lets the checker reach httptest servers while still
+// refusing every other non-public address.
+func allowLoopback(addr netip.Addr) bool {
+	return addr.IsLoopback() || urlpolicy.Public(addr)
+}
+
+func TestCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := newChecker(5*time.Second, allowLoopback)
+	ctx := context.Background()
+
+	tests := []struct {
+		path     string
+		ok       bool
+		status   int
+		finalURL string
+	}{
+		{"/ok", true, http.StatusOK, srv.URL + "/ok"},
+		{"/gone", false, http.StatusNotFound, srv.URL + "/gone"},
+		{"/moved", true, http.StatusOK, srv.URL + "/ok"},
+		{"/no-head", true, http.StatusOK, srv.URL + "/no-head"},
+	}
+	for _, tt := range tests {
+		res := c.Check(ctx, srv.URL+tt.path)
+		if res.OK() != tt.ok || res.StatusCode != tt.status || res.FinalURL != tt.finalURL {
+			t.Errorf("%s: got ok=%v status=%d final=%q err=%v", tt.path, res.OK(), res.StatusCode, res.FinalURL, res.Err)
+		}
+	}
+
+	// Contact links are skipped, not failed
+	if res := c.Check(ctx, "mailto:help@relief.example"); !res.Skipped || res.Err != nil {
+		t.Errorf("expected mailto link to be skipped, got %+v", res)
+	}
+
+	// Unreachable hosts report an error
+	srv.Close()
+	if res := c.Check(ctx, srv.URL+"/ok"); res.OK() || res.Err == nil {
+		t.Errorf("expected error for closed server, got %+v", res)
+	}
+}
+
+func TestCheckRefusesPrivateAddresses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://[::ffff:10.0.0.1]:8080/", http.StatusFound)
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := newChecker(5*time.Second, allowLoopback)
+	for _, path := range []string{"/metadata", "/private"} {
+		res := c.Check(ctx, srv.URL+path)
+		if res.OK() || !errors.Is(res.Err, urlpolicy.ErrPrivate) || res.FinalURL != "" {
+			t.Errorf("%s: expected the redirect to be refused, got %+v", path, res)
+		}
+	}
+	if res := c.Check(ctx, srv.URL+"/file"); res.OK() || !errors.Is(res.Err, urlpolicy.ErrScheme) {
+		t.Errorf("expected a non-web redirect to be refused, got %+v", res)
+	}
+
+	// The real checker won't even connect to the loopback test server
+	res := NewChecker(5*time.Second).Check(ctx, srv.URL+"/metadata")
+	if res.OK() || !errors.Is(res.Err, urlpolicy.ErrPrivate) {
+		t.Errorf("expected loopback to be refused, got %+v", res)
+	}
+}
@@ -0,0 +1,106 @@
+package linkcheck
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+type Store interface {
+	GetLinks(ctx context.Context) ([]models.Link, error)
+	GetLinkHealth(ctx context.Context) (map[string]models.LinkHealth, error)
+	UpdateLinkHealth(ctx context.Context, h models.LinkHealth) error
+}
+
+// Monitor checks every web link on each run and records the outcome,
+// counting consecutive failures per link.
+type Monitor struct {
+	store       Store
+	checker     *Checker
+	threshold   int
+	concurrency int
+	now         func() time.Time
+}
+
+// NewMonitor returns a monitor that considers a link broken after threshold
+// consecutive failed checks.
+func NewMonitor(store Store, checker *Checker, threshold int) *Monitor {
+	return &Monitor{
+		store:       store,
+		checker:     checker,
+		threshold:   threshold,
+		concurrency: 8,
+		now:         time.Now,
+	}
+}
+
+// Run checks all links once. It has the signature of a worker.Func.
+func (m *Monitor) Run(ctx context.Context) error {
+	links, err := m.store.GetLinks(ctx)
+	if err != nil {
+		return err
+	}
+	previous, err := m.store.GetLinkHealth(ctx)
+	if err != nil {
+		return err
+	}
+
+	urls := make([]string, len(links))
+	for i, l := range links {
+		urls[i] = l.URL
+	}
+	results := m.checker.CheckAll(ctx, urls, m.concurrency)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	checkedAt := m.now().UTC()
+	for i, l := range links {
+		res := results[i]
+		if res.Skipped {
+			continue
+		}
+		h := models.LinkHealth{
+			LinkID:     l.ID,
+			URL:        l.URL,
+			StatusCode: res.StatusCode,
+			FinalURL:   res.FinalURL,
+			CheckedAt:  checkedAt,
+		}
+		if res.Err != nil {
+			h.Error = res.Err.Error()
+		}
+		if !res.OK() {
+			// A result for a different URL predates an edit and does not count
+			if prev, ok := previous[l.ID]; ok && prev.URL == l.URL {
+				h.Failures = prev.Failures
+			}
+			h.Failures++
+			if h.Failures == m.threshold {
+				slog.Warn("Link looks broken", "link_id", l.ID, "url", l.URL, "failures", h.Failures)
+			}
+		}
+
+		if err := m.store.UpdateLinkHealth(ctx, h); err != nil {
+			slog.Error("Failed to save link health", "link_id", l.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// Broken returns the links whose current URL failed at least threshold
+// consecutive checks, keyed by link ID. A threshold below one disables it.
+func Broken(links []models.Link, health map[string]models.LinkHealth, threshold int) map[string]models.LinkHealth {
+	broken := make(map[string]models.LinkHealth)
+	if threshold < 1 {
+		return broken
+	}
+	for _, l := range links {
+		if h, ok := health[l.ID]; ok && h.URL == l.URL && h.Failures >= threshold {
+			broken[l.ID] = h
+		}
+	}
+	return broken
+}
@@ -0,0 +1,120 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database/memory"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func TestMonitorCountsConsecutiveFailures(t *testing.T) {
+	var flaky atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if flaky.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	db := memory.New()
+	ctx := context.Background()
+	links := []models.Link{
+		{ID: "ok", Title: "OK", URL: srv.URL + "/ok"},
+		{ID: "gone", Title: "Gone", URL: srv.URL + "/gone"},
+		{ID: "flaky", Title: "Flaky", URL: srv.URL + "/flaky"},
+	}
+	if err := db.AddLinks(ctx, links); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMonitor(db, newChecker(5*time.Second, allowLoopback), 2)
+	flaky.Store(true)
+	for range 2 {
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	health, _ := db.GetLinkHealth(ctx)
+	if health["ok"].Failures != 0 || health["ok"].StatusCode != http.StatusOK || health["ok"].CheckedAt.IsZero() {
+		t.Errorf("unexpected health for ok link: %+v", health["ok"])
+	}
+	if health["gone"].Failures != 2 || health["gone"].StatusCode != http.StatusGone {
+		t.Errorf("unexpected health for gone link: %+v", health["gone"])
+	}
+
+	current, _ := db.GetLinks(ctx)
+	broken := Broken(current, health, 2)
+	if len(broken) != 2 {
+		t.Errorf("expected gone and flaky to be broken, got %v", broken)
+	}
+
+	// One success resets the count
+	flaky.Store(false)
+	_ = m.Run(ctx)
+	health, _ = db.GetLinkHealth(ctx)
+	if health["flaky"].Failures != 0 {
+		t.Errorf("expected failures to reset, got %+v", health["flaky"])
+	}
+
+	// Editing the URL discards the old result
+	gone := links[1]
+	gone.URL = srv.URL + "/gone?v=2"
+	_ = db.UpdateLink(ctx, gone)
+	current, _ = db.GetLinks(ctx)
+	if broken := Broken(current, health, 2); len(broken) != 0 {
+		t.Errorf("expected edited link not to be flagged, got %v", broken)
+	}
+	_ = m.Run(ctx)
+	health, _ = db.GetLinkHealth(ctx)
+	if health["gone"].Failures != 1 {
+		t.Errorf("expected the new URL to start counting from one, got %+v", health["gone"])
+	}
+}
+
+func TestMonitorSkipsContactLinks(t *testing.T) {
+	db := memory.New()
+	ctx := context.Background()
+	links := []models.Link{
+		{ID: "mail", Title: "Mail", URL: "mailto:help@relief.example"},
+		{ID: "phone", Title: "Phone", URL: "tel:+15550100"},
+	}
+	if err := db.AddLinks(ctx, links); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMonitor(db, newChecker(5*time.Second, allowLoopback), 2)
+	for range 3 {
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	health, _ := db.GetLinkHealth(ctx)
+	if len(health) != 0 {
+		t.Errorf("expected contact links not to be checked, got %+v", health)
+	}
+	current, _ := db.GetLinks(ctx)
+	if broken := Broken(current, health, 2); len(broken) != 0 {
+		t.Errorf("expected contact links never to be flagged, got %v", broken)
+	}
+}
+
+func TestBrokenDisabled(t *testing.T) {
+	links := []models.Link{{ID: "a", URL: "https://a"}}
+	health := map[string]models.LinkHealth{"a": {LinkID: "a", URL: "https://a", Failures: 10}}
+	if broken := Broken(links, health, 0); len(broken) != 0 {
+		t.Errorf("expected a zero threshold to disable flagging, got %v", broken)
+	}
+}
@@ -0,0 +1,168 @@
+// Package linkcsv parses spreadsheets of links for bulk import.
+package linkcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/urlpolicy"
+)
+
+// MaxRows caps the number of data rows accepted in one upload.
+const MaxRows = 1000
+
+// Parse reads a CSV with a header row naming the columns (title, url,
+// category, icon, featured; any order, case-insensitive). It returns the
+// valid links and an error for every rejected row. Rows whose URL matches
+// an existing link or an earlier row are rejected as duplicates. Valid
+// links have no ID yet.
+func Parse(r io.Reader, existing []models.Link) ([]models.Link, []models.RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	for _, required := range []string{"title", "url"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+
+	seen := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		seen[normalizeURL(l.URL)] = true
+	}
+
+	var (
+		links  []models.Link
+		errs   []models.RowError
+		rowNum = 1
+	)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		rowNum++
+		if rowNum-1 > MaxRows {
+			return nil, nil, fmt.Errorf("too many rows (maximum %d)", MaxRows)
+		}
+		if err != nil {
+			errs = append(errs, models.RowError{Row: rowNum, Message: err.Error()})
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if isBlank(record) {
+			continue
+		}
+
+		link, err := parseRow(field)
+		if err != nil {
+			errs = append(errs, models.RowError{Row: rowNum, Message: err.Error()})
+			continue
+		}
+
+		key := normalizeURL(link.URL)
+		if seen[key] {
+			errs = append(errs, models.RowError{Row: rowNum, Message: "duplicate URL " + link.URL})
+			continue
+		}
+		seen[key] = true
+
+		links = append(links, link)
+	}
+
+	return links, errs, nil
+}
+
+func parseRow(field func(string) string) (models.Link, error) {
+	link := models.Link{
+		Title:    field("title"),
+		URL:      field("url"),
+		Category: strings.ToLower(field("category")),
+		Icon:     strings.ToLower(field("icon")),
+	}
+
+	if link.Title == "" {
+		return link, errors.New("title is required")
+	}
+	if link.URL == "" {
+		return link, errors.New("url is required")
+	}
+	normalized, err := urlpolicy.Link.Normalize(link.URL)
+	if err != nil {
+		return link, fmt.Errorf("url %q: %w", link.URL, err)
+	}
+	link.URL = normalized
+
+	if link.Category == "" {
+		link.Category = models.DefaultCategory
+	}
+	if !slices.Contains(models.Categories, link.Category) {
+		return link, fmt.Errorf("unknown category %q", link.Category)
+	}
+	if link.Icon == "" {
+		link.Icon = models.DefaultIcon
+	}
+	if !slices.Contains(models.Icons, link.Icon) {
+		return link, fmt.Errorf("unknown icon %q", link.Icon)
+	}
+
+	switch strings.ToLower(field("featured")) {
+	case "", "false", "no", "0":
+	case "true", "yes", "1":
+		link.Featured = true
+	default:
+		return link, fmt.Errorf("featured must be true or false, got %q", field("featured"))
+	}
+
+	return link, nil
+}
+
+func isBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeURL makes duplicate detection ignore case in the scheme and
+// host and a trailing slash.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return strings.TrimSpace(raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
@@ -0,0 +1,107 @@
+package linkcsv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	input := `Title,URL,Category,Icon,Featured
+Relief Fund,https://relief.example/donate,fundraiser,money,yes
+Rally,https://rally.example,demonstration,megaphone,
+,https://missing-title.example,news,book,
+Bad Scheme,javascript:alert(1),news,book,
+Unknown Category,https://cat.example,party,book,
+Unknown Icon,https://icon.example,news,rocket,
+Existing,https://EXISTING.example/,news,book,
+Repeat,https://relief.example/donate/,fundraiser,money,
+Defaults,https://defaults.example,,,
+Bad Featured,https://featured.example,news,book,maybe
+
+`
+	existing := []models.Link{{ID: "x", URL: "https://existing.example"}}
+
+	links, errs, err := Parse(strings.NewReader(input), existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(links) != 3 {
+		t.Fatalf("expected 3 valid links, got %d: %+v", len(links), links)
+	}
+	if links[0].Title != "Relief Fund" || !links[0].Featured || links[0].Icon != "money" {
+		t.Errorf("unexpected first link %+v", links[0])
+	}
+	if links[2].Category != "organization" || links[2].Icon != "link" {
+		t.Errorf("expected defaults for empty category and icon, got %+v", links[2])
+	}
+
+	wantRows := []int{4, 5, 6, 7, 8, 9, 11}
+	if len(errs) != len(wantRows) {
+		t.Fatalf("expected %d row errors, got %+v", len(wantRows), errs)
+	}
+	for i, row := range wantRows {
+		if errs[i].Row != row {
+			t.Errorf("expected error on row %d, got row %d (%s)", row, errs[i].Row, errs[i].Message)
+		}
+	}
+	if !strings.Contains(errs[4].Message, "duplicate") || !strings.Contains(errs[5].Message, "duplicate") {
+		t.Errorf("expected duplicate errors, got %+v", errs[4:6])
+	}
+}
+
+func TestParseAppliesURLPolicy(t *testing.T) {
+	input := `title,url
+Router,http://192.168.1.1/
+Metadata,http://169.254.169.254/latest
+Local,http://localhost:8080
+Data,"data:text/html,<script>alert(1)</script>"
+Tabbed,"java	script:alert(1)"
+Unicode,https://Bücher.example/Path
+`
+
+	links, errs, err := Parse(strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 5 {
+		t.Errorf("expected 5 rejected rows, got %+v", errs)
+	}
+	if len(links) != 1 || links[0].URL != "https://xn--bcher-kva.example/Path" {
+		t.Errorf("expected the unicode host in punycode, got %+v", links)
+	}
+}
+
+func TestParseColumnOrder(t *testing.T) {
+	input := "url,title\nhttps://a.example,A\n"
+
+	links, errs, err := Parse(strings.NewReader(input), nil)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("unexpected errors %v %+v", err, errs)
+	}
+	if len(links) != 1 || links[0].Title != "A" || links[0].URL != "https://a.example" {
+		t.Errorf("unexpected links %+v", links)
+	}
+}
+
+func TestParseRejectsBadFiles(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":       "",
+		"missing url": "title,category\nA,news\n",
+	} {
+		if _, _, err := Parse(strings.NewReader(input), nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("title,url\n")
+	for range MaxRows + 1 {
+		b.WriteString("A,https://a.example\n")
+	}
+	if _, _, err := Parse(strings.NewReader(b.String()), nil); err == nil {
+		t.Error("expected too many rows to be rejected")
+	}
+}
@@ -0,0 +1,167 @@
+// Package loginlimit slows down password guessing. Failed sign-ins are
+// counted per key (such as the client's address or the account tried), each
+// failure past the first few doubles the wait before the next attempt, and
+// enough of them lock the key out for a while, unless the limiter is
+// backoff-only.
+//
+// Counts are kept in memory, so the limits are per replica: behind a load
+// balancer spreading requests over N replicas, a guesser gets up to N times
+// the attempts before being slowed down or locked out.
+package loginlimit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// FreeAttempts is how many failures are allowed before backoff starts,
+	// so a mistyped password costs nothing.
+	FreeAttempts = 3
+	// BaseDelay is the wait after the first failure past FreeAttempts. It
+	// doubles with every further failure.
+	BaseDelay = time.Second
+	// LockoutAfter is the failure count at which a key is locked out.
+	LockoutAfter = 10
+	// LockoutDuration is how long a lockout lasts, counted from the last
+	// failure. It also caps the backoff.
+	LockoutDuration = 15 * time.Minute
+	// Forget is how long after its last failure a key starts over.
+	Forget = 24 * time.Hour
+	// BackoffOnlyMaxDelay caps the wait for keys of a NewBackoffOnly
+	// limiter, which are never locked out.
+	BackoffOnlyMaxDelay = time.Minute
+)
+
+// Backoff returns how long to wait after the given number of consecutive
+// failures.
+func Backoff(failures int) time.Duration {
+	if failures < FreeAttempts {
+		return 0
+	}
+	if failures >= LockoutAfter {
+		return LockoutDuration
+	}
+	return min(BaseDelay<<(failures-FreeAttempts), LockoutDuration)
+}
+
+type entry struct {
+	failures int
+	last     time.Time
+}
+
+// Limiter tracks failures in memory. Each replica keeps its own counts and
+// they are lost on restart; failures are only shared through the
+// login_failures log owners review.
+type Limiter struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	// backoffOnly limiters cap the wait at BackoffOnlyMaxDelay and never
+	// report a lockout.
+	backoffOnly bool
+	now         func() time.Time
+	lastPruned  time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{
+		entries: make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// NewBackoffOnly returns a Limiter that slows keys down like New but never
+// locks them out, for keys anyone can fail on someone else's behalf.
+func NewBackoffOnly() *Limiter {
+	l := New()
+	l.backoffOnly = true
+	return l
+}
+
+func (l *Limiter) backoff(failures int) time.Duration {
+	if l.backoffOnly {
+		return min(Backoff(failures), BackoffOnlyMaxDelay)
+	}
+	return Backoff(failures)
+}
+
+// Wait reports how long until any of keys may try again. Zero means the
+// attempt is allowed.
+func (l *Limiter) Wait(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		e, ok := l.entries[key]
+		if !ok {
+			continue
+		}
+		if remaining := e.last.Add(l.backoff(e.failures)).Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// Locked reports whether any of keys has failed often enough to be locked
+// out rather than merely slowed down.
+func (l *Limiter) Locked(keys ...string) bool {
+	if l.backoffOnly {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, key := range keys {
+		if e, ok := l.entries[key]; ok && e.failures >= LockoutAfter && now.Before(e.last.Add(LockoutDuration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fail records a failed attempt against every key.
+func (l *Limiter) Fail(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, key := range keys {
+		e := l.entries[key]
+		if now.Sub(e.last) > Forget {
+			e.failures = 0
+		}
+		e.failures++
+		e.last = now
+		l.entries[key] = e
+	}
+
+	// Failures are the only way keys are added, so pruning here keeps an
+	// attacker cycling through addresses from growing the map forever.
+	if now.Sub(l.lastPruned) > time.Minute {
+		l.prune(now)
+		l.lastPruned = now
+	}
+}
+
+// Reset forgets keys' failures after a successful sign-in.
+func (l *Limiter) Reset(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		delete(l.entries, key)
+	}
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for key, e := range l.entries {
+		if now.Sub(e.last) > Forget {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package loginlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:  0,
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		9:  64 * time.Second,
+		10: LockoutDuration,
+		50: LockoutDuration,
+	}
+	for failures, want := range tests {
+		if got := Backoff(failures); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New()
+	l.now = func() time.Time { return now }
+
+	for range FreeAttempts - 1 {
+		l.Fail("ip:a", "user:sam")
+	}
+	if wait := l.Wait("ip:a", "user:sam"); wait != 0 {
+		t.Fatalf("expected free attempts to cost nothing, got %v", wait)
+	}
+
+	l.Fail("ip:a", "user:sam")
+	if wait := l.Wait("ip:b", "user:sam"); wait != BaseDelay {
+		t.Errorf("expected the account to be slowed down from any address, got %v", wait)
+	}
+	if wait := l.Wait("ip:a", "user:olive"); wait != BaseDelay {
+		t.Errorf("expected the address to be slowed down for any account, got %v", wait)
+	}
+	if wait := l.Wait("ip:b", "user:olive"); wait != 0 {
+		t.Errorf("expected unrelated keys to be unaffected, got %v", wait)
+	}
+
+	now = now.Add(BaseDelay)
+	if wait := l.Wait("ip:a", "user:sam"); wait != 0 {
+		t.Errorf("expected the wait to be over, got %v", wait)
+	}
+
+	for range LockoutAfter - FreeAttempts {
+		l.Fail("user:sam")
+	}
+	if !l.Locked("user:sam") || l.Locked("ip:a") {
+		t.Error("expected only the account to be locked out")
+	}
+	if wait := l.Wait("user:sam"); wait != LockoutDuration {
+		t.Errorf("expected a full lockout, got %v", wait)
+	}
+
+	now = now.Add(LockoutDuration)
+	if l.Locked("user:sam") || l.Wait("user:sam") != 0 {
+		t.Error("expected the lockout to expire")
+	}
+
+	l.Reset("user:sam")
+	l.Fail("user:sam")
+	if wait := l.Wait("user:sam"); wait != 0 {
+		t.Errorf("expected Reset to forget earlier failures, got %v", wait)
+	}
+
+	now = now.Add(Forget + time.Minute)
+	l.Fail("ip:a")
+	if _, ok := l.entries["user:sam"]; ok {
+		t.Error("expected stale keys to be pruned")
+	}
+	if wait := l.Wait("ip:a"); wait != 0 {
+		t.Errorf("expected failures older than Forget to start over, got %v", wait)
+	}
+}
+
+func TestBackoffOnlyLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewBackoffOnly()
+	l.now = func() time.Time { return now }
+
+	for range FreeAttempts {
+		l.Fail("sam")
+	}
+	if wait := l.Wait("sam"); wait != BaseDelay {
+		t.Errorf("expected backoff to start as usual, got %v", wait)
+	}
+
+	for range LockoutAfter * 2 {
+		l.Fail("sam")
+	}
+	if l.Locked("sam") {
+		t.Error("expected a backoff-only key never to be locked out")
+	}
+	if wait := l.Wait("sam"); wait != BackoffOnlyMaxDelay {
+		t.Errorf("expected the wait to stop at %v, got %v", BackoffOnlyMaxDelay, wait)
+	}
+}
@@ -1,5 +1,45 @@
 package models
 
+import (
+	"html/template"
+	"time"
+)
+
+// Categories, Icons and BannerTypes list the values the admin forms offer
+// and the public page knows how to render.
+var (
+	Categories  = []string{"fundraiser", "demonstration", "organization", "news"}
+	Icons       = []string{"heart", "money", "megaphone", "people", "fist", "shield", "globe", "book", "link"}
+	BannerTypes = []string{"info", "urgent", "success"}
+)
+
+// IconEmoji is how each of Icons is drawn.
+var IconEmoji = map[string]string{
+	"heart":     "❤️",
+	"money":     "💰",
+	"megaphone": "📢",
+	"people":    "👥",
+	"fist":      "✊",
+	"shield":    "🛡️",
+	"globe":     "🌍",
+	"book":      "📖",
+	"link":      "🔗",
+}
+
+// Option is one choice in an admin form's select.
+type Option struct {
+	Value string
+	Label string
+}
+
+// DefaultCategory and DefaultIcon are used for links that don't name one,
+// and DefaultBannerType for a banner without a type.
+const (
+	DefaultCategory   = "organization"
+	DefaultIcon       = "link"
+	DefaultBannerType = "info"
+)
+
 type Link struct {
 	ID       string
 	Title    string
@@ -7,6 +47,112 @@ type Link struct {
 	Category string
 	Icon     string
 	Featured bool
+	// PublishAt and ExpiresAt optionally limit when the link appears on the
+	// public page. Nil means no limit on that side.
+	PublishAt *time.Time
+	ExpiresAt *time.Time
+}
+
+// Link statuses reported by Status.
+const (
+	LinkLive      = "live"
+	LinkScheduled = "scheduled"
+	LinkExpired   = "expired"
+)
+
+// Status reports whether the link is live at now, not yet published, or
+// past its expiry.
+func (l Link) Status(now time.Time) string {
+	switch {
+	case l.PublishAt != nil && now.Before(*l.PublishAt):
+		return LinkScheduled
+	case l.ExpiresAt != nil && !now.Before(*l.ExpiresAt):
+		return LinkExpired
+	default:
+		return LinkLive
+	}
+}
+
+// LiveLinks returns the links that are live at now, keeping their order.
+func LiveLinks(links []Link, now time.Time) []Link {
+	live := make([]Link, 0, len(links))
+	for _, l := range links {
+		if l.Status(now) == LinkLive {
+			live = append(live, l)
+		}
+	}
+	return live
+}
+
+// Admin roles, from most to least privileged. Owners manage users, editors
+// change content and viewers only read the admin pages.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var Roles = []string{RoleOwner, RoleEditor, RoleViewer}
+
+type User struct {
+	Username  string
+	Role      string
+	CreatedAt time.Time
+	// TwoFactor is set once the user has enrolled an authenticator app.
+	TwoFactor bool
+}
+
+// Can reports whether the user's role is at least role.
+func (u User) Can(role string) bool {
+	return roleRank(u.Role) >= roleRank(role) && roleRank(role) > 0
+}
+
+// ValidUsername reports whether name is 2 to 32 characters of lowercase
+// letters, digits, dots, dashes and underscores.
+func ValidUsername(name string) bool {
+	if len(name) < 2 || len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func roleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Session is a signed-in admin. A pending session has passed the password
+// check but still needs a second factor, and doesn't grant access.
+type Session struct {
+	// ID is the hash of the session's token. It identifies the session on
+	// the sessions page but can't be used to sign in.
+	ID         string
+	Username   string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	// Address is the network the session signed in from, such as
+	// 203.0.113.0/24.
+	Address string
+	// CSRFToken must be sent back with every form posted by this session.
+	CSRFToken string
+	Pending   bool
+	// Attempts counts wrong second-factor codes on a pending session.
+	Attempts int
 }
 
 type Profile struct {
@@ -24,17 +170,291 @@ type Banner struct {
 	Type    string
 }
 
+// ScheduledBanner is an announcement shown between StartsAt and EndsAt. Nil
+// means no limit on that side. When several are active the one with the
+// highest Priority wins.
+type ScheduledBanner struct {
+	ID       string
+	Text     string
+	Link     string
+	Type     string
+	Priority int
+	StartsAt *time.Time
+	EndsAt   *time.Time
+}
+
+// Banner statuses reported by ScheduledBanner.Status.
+const (
+	BannerUpcoming = "upcoming"
+	BannerActive   = "active"
+	BannerPast     = "past"
+)
+
+func (b ScheduledBanner) Status(now time.Time) string {
+	switch {
+	case b.StartsAt != nil && now.Before(*b.StartsAt):
+		return BannerUpcoming
+	case b.EndsAt != nil && !now.Before(*b.EndsAt):
+		return BannerPast
+	default:
+		return BannerActive
+	}
+}
+
+// Banner converts b to the enabled banner rendered on the public page.
+func (b ScheduledBanner) Banner() Banner {
+	return Banner{Enabled: true, Text: b.Text, Link: b.Link, Type: b.Type}
+}
+
+// ActiveBanner picks the banner to show at now: the highest priority among
+// the active ones, and of those the one that started most recently.
+func ActiveBanner(banners []ScheduledBanner, now time.Time) (ScheduledBanner, bool) {
+	var best ScheduledBanner
+	found := false
+	for _, b := range banners {
+		if b.Status(now) != BannerActive {
+			continue
+		}
+		if !found || b.Priority > best.Priority || (b.Priority == best.Priority && startsAfter(b, best)) {
+			best, found = b, true
+		}
+	}
+	return best, found
+}
+
+func startsAfter(a, b ScheduledBanner) bool {
+	if a.StartsAt == nil {
+		return false
+	}
+	return b.StartsAt == nil || a.StartsAt.After(*b.StartsAt)
+}
+
+// Content is everything an export covers, replaced as a unit on import.
+type Content struct {
+	Profile Profile
+	Links   []Link
+	Banner  Banner
+	// ScheduledBanners replaces the banner queue. Nil leaves the queue as
+	// it is, for exports made before banners were included.
+	ScheduledBanners []ScheduledBanner
+}
+
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+type LinkChange struct {
+	ID      string
+	Title   string
+	Changes []FieldChange
+}
+
+type BannerChange struct {
+	ID      string
+	Text    string
+	Changes []FieldChange
+}
+
+// ContentDiff describes what an import would change.
+type ContentDiff struct {
+	Profile   []FieldChange
+	Banner    []FieldChange
+	Added     []Link
+	Removed   []Link
+	Updated   []LinkChange
+	Reordered bool
+	// Scheduled banners matched by ID.
+	BannersAdded   []ScheduledBanner
+	BannersRemoved []ScheduledBanner
+	BannersUpdated []BannerChange
+}
+
+func (d ContentDiff) Empty() bool {
+	return len(d.Profile) == 0 && len(d.Banner) == 0 && len(d.Added) == 0 &&
+		len(d.Removed) == 0 && len(d.Updated) == 0 && !d.Reordered &&
+		len(d.BannersAdded) == 0 && len(d.BannersRemoved) == 0 && len(d.BannersUpdated) == 0
+}
+
+// LinkHealth is the latest dead-link check of a link. URL is the address
+// that was checked, so a result goes stale once the link is edited.
+type LinkHealth struct {
+	LinkID     string
+	URL        string
+	StatusCode int
+	FinalURL   string
+	Error      string
+	// Failures counts consecutive failed checks.
+	Failures  int
+	CheckedAt time.Time
+}
+
 type AdminPageData struct {
 	Profile Profile
 	Links   []Link
 	Banner  Banner
+	Clicks  map[string]int
+	// Broken holds the links that failed enough consecutive checks, keyed
+	// by link ID.
+	Broken     map[string]LinkHealth
+	HideBroken bool
+	// Now is the time link statuses are shown for.
+	Now      time.Time
+	EditLink *Link
+	// Categories and Icons are the choices offered by the link form.
+	Categories []Option
+	Icons      []Option
+	// User is the signed-in account; controls it can't use are hidden.
+	User User
+	// CSRFToken is echoed back by every form on the page.
+	CSRFToken string
+	// Nonce is the Content-Security-Policy nonce for the page's scripts.
+	Nonce   string
 	Message string
 	Error   string
 }
 
+type BannersPageData struct {
+	// Active is ordered as ActiveBanner would choose, so the first entry
+	// is the one on the public page.
+	Active   []ScheduledBanner
+	Upcoming []ScheduledBanner
+	Past     []ScheduledBanner
+	// Fallback is the default banner shown when none is active.
+	Fallback  Banner
+	User      User
+	CSRFToken string
+	Message   string
+	Error     string
+}
+
+type UsersPageData struct {
+	Users     []User
+	Roles     []string
+	User      User
+	CSRFToken string
+	Message   string
+	Error     string
+}
+
+type TwoFactorPageData struct {
+	User      User
+	CSRFToken string
+	// Secret is the secret being enrolled, shown for manual entry next to
+	// QRCode, a data: URL of the same secret.
+	Secret string
+	QRCode template.URL
+	// RecoveryCodes is only set right after enrolling; they are never
+	// shown again.
+	RecoveryCodes []string
+	RecoveryLeft  int
+	Message       string
+	Error         string
+}
+
+// LoginFailure is a rejected sign-in. Username is what was typed, which may
+// not be an account.
+type LoginFailure struct {
+	Username  string
+	Address   string
+	UserAgent string
+	Reason    string
+	At        time.Time
+}
+
+const (
+	LoginFailurePassword = "password"
+	LoginFailureCode     = "code"
+)
+
+type LoginFailuresPageData struct {
+	User User
+	// Failures holds the most recent failures, newest first.
+	Failures []LoginFailure
+}
+
+type SessionsPageData struct {
+	User      User
+	CSRFToken string
+	// Sessions holds the user's own sessions, or everyone's for owners.
+	Sessions []Session
+	// CurrentID is the ID of the session viewing the page.
+	CurrentID string
+	Message   string
+	Error     string
+}
+
+type ErrorPageData struct {
+	Status  int
+	Title   string
+	Message string
+}
+
 type IndexPageData struct {
 	Profile     Profile
 	Links       []Link
 	Banner      Banner
 	LastUpdated string
+	// From is the visitor's referring domain, carried on link URLs so the
+	// click is attributed to the same source as the page view. FromSig
+	// signs it, so a click can't be credited to a made-up source.
+	From    string
+	FromSig string
+	// Nonce is the Content-Security-Policy nonce for the page's scripts.
+	Nonce string
+}
+
+type ImportPageData struct {
+	Diff       ContentDiff
+	Document   string
+	ExportedAt string
+	CSRFToken  string
+	Error      string
+}
+
+type RowError struct {
+	Row     int
+	Message string
+}
+
+type CSVImportPageData struct {
+	Added  []Link
+	Errors []RowError
+}
+
+const (
+	AnalyticsView  = "view"
+	AnalyticsClick = "click"
+)
+
+// AnalyticsCount is an increment to one daily counter bucket. Day is
+// formatted as YYYY-MM-DD in UTC.
+type AnalyticsCount struct {
+	Day      string
+	Kind     string
+	Referrer string
+	Count    int
+}
+
+type AnalyticsRow struct {
+	Day      string
+	Referrer string
+	Views    int
+	Clicks   int
+}
+
+type AnalyticsTotal struct {
+	Label  string
+	Views  int
+	Clicks int
+}
+
+type AnalyticsPageData struct {
+	Days          int
+	RetentionDays int
+	Views         int
+	Clicks        int
+	Daily         []AnalyticsTotal
+	Referrers     []AnalyticsTotal
 }
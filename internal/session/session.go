@@ -0,0 +1,232 @@
+// Package session stores admin login sessions. The browser holds a random
+// token; persistent stores only keep its hash, so a leaked table can't be
+// used to sign in.
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Store keeps sessions by token. Get reports ErrNotFound for unknown and
+// expired sessions alike. Sessions are also known by their ID, the hash of
+// their token, so they can be listed and revoked without revealing tokens.
+type Store interface {
+	Create(ctx context.Context, token string, s models.Session) error
+	Get(ctx context.Context, token string) (models.Session, error)
+	Update(ctx context.Context, token string, s models.Session) error
+	Delete(ctx context.Context, token string) error
+	// List returns every signed-in session, most recently used first.
+	// Pending and expired sessions are left out.
+	List(ctx context.Context) ([]models.Session, error)
+	// Revoke deletes the session with the given ID.
+	Revoke(ctx context.Context, id string) error
+	// RevokeUser deletes username's sessions except the one with ID keep,
+	// which may be empty, and reports how many were removed.
+	RevokeUser(ctx context.Context, username, keep string) (int, error)
+	// DeleteExpired removes sessions that expired before now and reports
+	// how many were removed.
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// HashToken returns the form a token is stored under.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CoarseAddress reduces a client address, with or without a port, to its
+// /24 (IPv4) or /48 (IPv6) network: enough to tell home from office without
+// keeping anyone's exact IP. It returns "" for anything unparseable.
+func CoarseAddress(addr string) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		ap, err := netip.ParseAddrPort(addr)
+		if err != nil {
+			return ""
+		}
+		ip = ap.Addr()
+	}
+	ip = ip.Unmap().WithZone("")
+
+	bits := 48
+	if ip.Is4() {
+		bits = 24
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// MemoryStore keeps sessions in process, by ID like the persistent store.
+// They are lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]models.Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]models.Session)}
+}
+
+func (m *MemoryStore) Create(ctx context.Context, token string, s models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.ID = HashToken(token)
+	m.sessions[s.ID] = s
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, token string) (models.Session, error) {
+	m.mu.RLock()
+	s, ok := m.sessions[HashToken(token)]
+	m.mu.RUnlock()
+
+	if !ok || time.Now().After(s.ExpiresAt) {
+		return models.Session{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) Update(ctx context.Context, token string, s models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := HashToken(token)
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	s.ID = id
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, token string) error {
+	return m.Revoke(ctx, HashToken(token))
+}
+
+func (m *MemoryStore) List(ctx context.Context) ([]models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if !s.Pending && now.Before(s.ExpiresAt) {
+			sessions = append(sessions, s)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b models.Session) int { return b.LastSeenAt.Compare(a.LastSeenAt) })
+	return sessions, nil
+}
+
+func (m *MemoryStore) Revoke(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemoryStore) RevokeUser(ctx context.Context, username, keep string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, s := range m.sessions {
+		if s.Username == username && id != keep {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// DB is the part of the database the persistent store needs.
+type DB interface {
+	CreateSession(ctx context.Context, hash string, s models.Session) error
+	GetSession(ctx context.Context, hash string) (models.Session, error)
+	ListSessions(ctx context.Context, now time.Time) ([]models.Session, error)
+	UpdateSession(ctx context.Context, hash string, s models.Session) error
+	DeleteSession(ctx context.Context, hash string) error
+	DeleteUserSessions(ctx context.Context, username, keep string) (int, error)
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error)
+}
+
+// DBStore keeps sessions in the database so they survive restarts and are
+// shared by every replica.
+type DBStore struct {
+	db DB
+}
+
+func NewDBStore(db DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (d *DBStore) Create(ctx context.Context, token string, s models.Session) error {
+	return d.db.CreateSession(ctx, HashToken(token), s)
+}
+
+func (d *DBStore) Get(ctx context.Context, token string) (models.Session, error) {
+	s, err := d.db.GetSession(ctx, HashToken(token))
+	if errors.Is(err, database.ErrSessionNotFound) || err == nil && time.Now().After(s.ExpiresAt) {
+		return models.Session{}, ErrNotFound
+	}
+	return s, err
+}
+
+func (d *DBStore) Update(ctx context.Context, token string, s models.Session) error {
+	err := d.db.UpdateSession(ctx, HashToken(token), s)
+	if errors.Is(err, database.ErrSessionNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (d *DBStore) Delete(ctx context.Context, token string) error {
+	return d.db.DeleteSession(ctx, HashToken(token))
+}
+
+func (d *DBStore) List(ctx context.Context) ([]models.Session, error) {
+	return d.db.ListSessions(ctx, time.Now())
+}
+
+func (d *DBStore) Revoke(ctx context.Context, id string) error {
+	return d.db.DeleteSession(ctx, id)
+}
+
+func (d *DBStore) RevokeUser(ctx context.Context, username, keep string) (int, error) {
+	return d.db.DeleteUserSessions(ctx, username, keep)
+}
+
+func (d *DBStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	return d.db.DeleteExpiredSessions(ctx, now)
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database/memory"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func TestStores(t *testing.T) {
+	db := memory.New()
+	stores := map[string]Store{
+		"memory":   NewMemoryStore(),
+		"database": NewDBStore(db),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+
+			live := models.Session{Username: memory.DefaultUsername, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+			if err := store.Create(ctx, "live", live); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Create(ctx, "stale", models.Session{Username: memory.DefaultUsername, ExpiresAt: now.Add(-time.Minute)}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := store.Get(ctx, "live"); err != nil || got.Username != memory.DefaultUsername {
+				t.Errorf("expected live session, got %+v, %v", got, err)
+			}
+			if _, err := store.Get(ctx, "stale"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected expired session to be ErrNotFound, got %v", err)
+			}
+			if _, err := store.Get(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected unknown session to be ErrNotFound, got %v", err)
+			}
+
+			live.Attempts = 3
+			if err := store.Update(ctx, "live", live); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.Get(ctx, "live"); got.Attempts != 3 {
+				t.Errorf("expected update to be kept, got %+v", got)
+			}
+			if err := store.Update(ctx, "unknown", live); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound updating unknown session, got %v", err)
+			}
+
+			if n, err := store.DeleteExpired(ctx, now); err != nil || n != 1 {
+				t.Errorf("expected 1 expired session removed, got %d, %v", n, err)
+			}
+
+			if err := store.Create(ctx, "pending", models.Session{Username: memory.DefaultUsername, ExpiresAt: now.Add(time.Hour), Pending: true}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Create(ctx, "other", models.Session{Username: memory.DefaultUsername, LastSeenAt: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+			list, err := store.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 2 || list[0].ID != HashToken("other") || list[1].ID != HashToken("live") {
+				t.Fatalf("expected the 2 signed-in sessions by last use, got %+v", list)
+			}
+
+			if n, err := store.RevokeUser(ctx, memory.DefaultUsername, HashToken("live")); err != nil || n != 2 {
+				t.Errorf("expected 2 other sessions revoked, got %d, %v", n, err)
+			}
+			if _, err := store.Get(ctx, "other"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected revoked session to be ErrNotFound, got %v", err)
+			}
+			if _, err := store.Get(ctx, "live"); err != nil {
+				t.Errorf("expected the kept session to survive, got %v", err)
+			}
+
+			if err := store.Delete(ctx, "live"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(ctx, "live"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected deleted session to be ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDBStoreHashesTokens(t *testing.T) {
+	db := memory.New()
+	store := NewDBStore(db)
+	ctx := context.Background()
+
+	sess := models.Session{Username: memory.DefaultUsername, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.Create(ctx, "token", sess); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.GetSession(ctx, "token"); err == nil {
+		t.Error("expected the raw token not to be stored")
+	}
+	if _, err := db.GetSession(ctx, HashToken("token")); err != nil {
+		t.Errorf("expected the session under the token's hash, got %v", err)
+	}
+}
+
+func TestCoarseAddress(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.77":             "203.0.113.0/24",
+		"203.0.113.77:5555":        "203.0.113.0/24",
+		"[::ffff:203.0.113.77]:80": "203.0.113.0/24",
+		"2001:db8:1234:5678::1":    "2001:db8:1234::/48",
+		"[2001:db8::1%eth0]:443":   "2001:db8::/48",
+		"not an address":           "",
+		"":                         "",
+	}
+	for addr, want := range tests {
+		if got := CoarseAddress(addr); got != want {
+			t.Errorf("CoarseAddress(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
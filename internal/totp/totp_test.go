@@ -0,0 +1,104 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B, truncated to six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Counter(now))
+
+	counter, ok := Verify(rfcSecret, code, now)
+	if !ok || counter != Counter(now) {
+		t.Fatalf("expected current code to verify at step %d, got %d, %v", Counter(now), counter, ok)
+	}
+	if _, ok := Verify(rfcSecret, code[:3]+" "+code[3:], now.Add(Period)); !ok {
+		t.Error("expected a code from the previous step with a space to verify")
+	}
+	if _, ok := Verify(rfcSecret, code, now.Add(3*Period)); ok {
+		t.Error("expected a stale code to be rejected")
+	}
+	if _, ok := Verify(rfcSecret, "12345", now); ok {
+		t.Error("expected a short code to be rejected")
+	}
+	if _, ok := Verify("not base32!", code, now); ok {
+		t.Error("expected an invalid secret to be rejected")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("expected a 32 character secret, got %q", secret)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("expected generated secret to be usable, got %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Stand With Iran", "sam", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Stand%20With%20Iran:sam?") {
+		t.Errorf("unexpected label in %q", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=Stand+With+Iran") {
+		t.Errorf("unexpected parameters in %q", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("unexpected code format %q", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Error("expected hashing to ignore case, spaces and dashes")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("expected different codes to hash differently")
+	}
+}
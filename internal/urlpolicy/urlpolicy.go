@@ -0,0 +1,252 @@
+// Package urlpolicy decides which URLs may be published on the site. Links,
+// banner targets and the avatar end up in href and src attributes, so
+// anything that isn't plainly a public web (or contact) address is refused
+// before it is stored.
+package urlpolicy
+
+import (
+	"errors"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// MaxLength is the longest URL accepted.
+const MaxLength = 2048
+
+var (
+	ErrInvalid = errors.New("not a valid address")
+	ErrScheme  = errors.New("that kind of address isn't allowed")
+	ErrPrivate = errors.New("address points to a private or local network")
+)
+
+// Policy is a set of rules for one kind of URL.
+type Policy struct {
+	// AllowContact also accepts mailto: and tel: links.
+	AllowContact bool
+	// StripTracking removes tracking parameters such as utm_source and
+	// fbclid from the query.
+	StripTracking bool
+}
+
+var (
+	// Link is the policy for links and banner targets.
+	Link = Policy{AllowContact: true}
+	// Image is the policy for images loaded by the public page.
+	Image = Policy{}
+)
+
+// Normalize checks raw against the policy and returns it in the form to
+// store: scheme and host lowercased, international hosts in punycode and,
+// if the policy asks, tracking parameters removed.
+func (p Policy) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > MaxLength {
+		return "", ErrInvalid
+	}
+	// Browsers drop tabs and newlines inside URLs, which would let
+	// "java\nscript:" slip past the scheme check
+	if strings.ContainsFunc(raw, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return "", ErrInvalid
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	switch u.Scheme {
+	case "http", "https":
+		return p.normalizeWeb(u)
+	case "mailto":
+		if !p.AllowContact {
+			return "", ErrScheme
+		}
+		return normalizeMailto(u)
+	case "tel":
+		if !p.AllowContact {
+			return "", ErrScheme
+		}
+		return normalizeTel(u)
+	case "":
+		return "", ErrInvalid
+	default:
+		return "", ErrScheme
+	}
+}
+
+func (p Policy) normalizeWeb(u *url.URL) (string, error) {
+	if u.Opaque != "" || u.User != nil {
+		// user:pass@ hosts are a phishing trick: https://bank.example@evil.example
+		return "", ErrInvalid
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if p.StripTracking {
+		u.RawQuery = stripTracking(u.RawQuery)
+		u.ForceQuery = false
+	}
+	return u.String(), nil
+}
+
+// normalizeHost returns host as lowercase ASCII, refusing local names and
+// addresses that aren't publicly routable.
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrInvalid
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !Public(addr) {
+			return "", ErrPrivate
+		}
+		return addr.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil || ascii == "" {
+		return "", ErrInvalid
+	}
+
+	labels := strings.Split(ascii, ".")
+	last := labels[len(labels)-1]
+	// Browsers read hosts ending in a number as IPv4 in any of its forms
+	// (2130706433, 0x7f.1, 127.1), all of which ParseAddr refused above
+	if numeric.MatchString(last) {
+		return "", ErrInvalid
+	}
+	if len(labels) == 1 || localSuffixes[last] {
+		return "", ErrPrivate
+	}
+	return ascii, nil
+}
+
+var numeric = regexp.MustCompile(`^(0x[0-9a-f]*|[0-9]+)$`)
+
+// localSuffixes are top-level names that only resolve on local networks.
+var localSuffixes = map[string]bool{
+	"localhost": true,
+	"local":     true,
+	"internal":  true,
+	"lan":       true,
+	"home":      true,
+	"intranet":  true,
+	"corp":      true,
+}
+
+// Public reports whether addr is reachable on the public internet, as
+// opposed to loopback, private, link-local or otherwise reserved.
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.Zone() != "" {
+		return false
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// reserved are ranges netip has no predicate for that still never reach the
+// public internet.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"), // documentation
+}
+
+func normalizeMailto(u *url.URL) (string, error) {
+	to := u.Opaque
+	if to == "" {
+		return "", ErrInvalid
+	}
+	decoded, err := url.PathUnescape(to)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	for _, addr := range strings.Split(decoded, ",") {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return "", ErrInvalid
+		}
+	}
+	return u.String(), nil
+}
+
+var phoneNumber = regexp.MustCompile(`^\+?[0-9][0-9().\-]{2,30}$`)
+
+func normalizeTel(u *url.URL) (string, error) {
+	if !phoneNumber.MatchString(u.Opaque) || u.RawQuery != "" || u.Fragment != "" {
+		return "", ErrInvalid
+	}
+	return "tel:" + u.Opaque, nil
+}
+
+// trackingParams are query parameters that only identify the campaign or
+// click a link was shared from.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"gbraid":  true,
+	"wbraid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"twclid":  true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+}
+
+func isTracking(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// stripTracking drops tracking parameters from a raw query, keeping the
+// rest in their original order and encoding.
+func stripTracking(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if pair != "" && !isTracking(name) {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,157 @@
+// Package worker runs the periodic background jobs (analytics flushing,
+// retention, link checks) next to the HTTP server.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Func func(ctx context.Context) error
+
+// stallIntervals is how many intervals a worker may go without finishing a
+// run before Check reports it stuck.
+const stallIntervals = 3
+
+type worker struct {
+	name     string
+	interval time.Duration
+	fn       Func
+	// immediate runs fn as soon as the group starts instead of waiting for
+	// the first tick.
+	immediate bool
+	// busy is set while fn runs, so a stuck worker can be named when
+	// shutdown gives up on it.
+	busy atomic.Bool
+	// running is set while the worker's goroutine is alive.
+	running atomic.Bool
+	// lastDone is when the worker started or last finished a run, in Unix
+	// nanoseconds.
+	lastDone atomic.Int64
+}
+
+// Group starts a set of workers together and stops them together.
+type Group struct {
+	workers []*worker
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// Add registers fn to run every interval once the group is started. It must
+// be called before Start.
+func (g *Group) Add(name string, interval time.Duration, fn Func) {
+	g.workers = append(g.workers, &worker{name: name, interval: interval, fn: fn})
+}
+
+// AddImmediate is like Add, but also runs fn once as soon as the group
+// starts. Use it for long intervals, which a restart would otherwise
+// postpone each time.
+func (g *Group) AddImmediate(name string, interval time.Duration, fn Func) {
+	g.workers = append(g.workers, &worker{name: name, interval: interval, fn: fn, immediate: true})
+}
+
+func (g *Group) Start(ctx context.Context) {
+	ctx, g.cancel = context.WithCancel(ctx)
+	for _, w := range g.workers {
+		g.wg.Add(1)
+		w.running.Store(true)
+		w.lastDone.Store(time.Now().UnixNano())
+		go func() {
+			defer g.wg.Done()
+			w.run(ctx)
+		}()
+	}
+}
+
+// Shutdown cancels every worker and waits for in-flight runs to return, or
+// for ctx to be done. In that case it returns an error naming the workers
+// that ignored cancellation; they are left running.
+func (g *Group) Shutdown(ctx context.Context) error {
+	if g.cancel != nil {
+		g.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers still running: %s", strings.Join(g.busy(), ", "))
+	}
+}
+
+// Check returns an error naming any worker whose goroutine isn't running,
+// because the group was never started or has been stopped, or that has gone
+// several intervals without finishing a run.
+func (g *Group) Check(ctx context.Context) error {
+	now := time.Now()
+	var problems []string
+	for _, w := range g.workers {
+		idle := now.Sub(time.Unix(0, w.lastDone.Load()))
+		switch {
+		case !w.running.Load():
+			problems = append(problems, w.name+" is not running")
+		case idle > stallIntervals*w.interval:
+			problems = append(problems, fmt.Sprintf("%s has not finished a run in %s", w.name, idle.Round(time.Second)))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (g *Group) busy() []string {
+	var names []string
+	for _, w := range g.workers {
+		if w.busy.Load() {
+			names = append(names, w.name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (w *worker) run(ctx context.Context) {
+	defer w.running.Store(false)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	if w.immediate {
+		w.runOnce(ctx)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.runOnce(ctx)
+		}
+	}
+}
+
+func (w *worker) runOnce(ctx context.Context) {
+	w.busy.Store(true)
+	err := w.fn(ctx)
+	w.busy.Store(false)
+	w.lastDone.Store(time.Now().UnixNano())
+	if err != nil && ctx.Err() == nil {
+		slog.Error("Background worker failed", "worker", w.name, "error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupRunsAndShutsDown(t *testing.T) {
+	var runs atomic.Int32
+	g := NewGroup()
+	g.Add("counter", 5*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	g.Start(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	_ = g.Shutdown(context.Background())
+
+	after := runs.Load()
+	if after == 0 {
+		t.Fatal("expected worker to run at least once")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("expected worker not to run after Shutdown")
+	}
+}
+
+func TestAddImmediateRunsAtStart(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	g := NewGroup()
+	g.AddImmediate("eager", time.Hour, func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	})
+
+	g.Start(context.Background())
+	defer g.Shutdown(context.Background())
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("expected the worker to run without waiting for its interval")
+	}
+}
+
+func TestShutdownWaitsForRunningWork(t *testing.T) {
+	var finished atomic.Bool
+	started := make(chan struct{})
+	g := NewGroup()
+	g.Add("slow", time.Millisecond, func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	})
+
+	g.Start(context.Background())
+	<-started
+	_ = g.Shutdown(context.Background())
+
+	if !finished.Load() {
+		t.Error("expected Shutdown to wait for the in-flight run")
+	}
+}
+
+func TestShutdownGivesUpOnStuckWorker(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup()
+	g.Add("stuck", time.Millisecond, func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+			return nil
+		}
+		<-release // ignores ctx
+		return nil
+	})
+
+	g.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := g.Shutdown(ctx)
+	if err == nil || !strings.Contains(err.Error(), "stuck") {
+		t.Errorf("expected an error naming the stuck worker, got %v", err)
+	}
+
+	close(release)
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected the group to stop once the worker returned, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup()
+	g.Add("quick", time.Millisecond, func(ctx context.Context) error { return nil })
+	g.Add("stuck", 5*time.Millisecond, func(ctx context.Context) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	if err := g.Check(context.Background()); err == nil {
+		t.Error("expected an error before the group is started")
+	}
+
+	g.Start(context.Background())
+	if err := g.Check(context.Background()); err != nil {
+		t.Errorf("expected a freshly started group to pass, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	err := g.Check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "stuck") || strings.Contains(err.Error(), "quick") {
+		t.Errorf("expected only the stuck worker to be reported, got %v", err)
+	}
+
+	close(release)
+	_ = g.Shutdown(context.Background())
+	if err := g.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Errorf("expected stopped workers to be reported, got %v", err)
+	}
+}
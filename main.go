@@ -1,18 +1,12 @@
 package main
 
 import (
-	"context"
 	"embed"
 	"fmt"
-	"html/template"
-	"log/slog"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"strings"
 
-	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/config"
 	"github.com/alexraskin/standwithiran/server"
 )
 
@@ -26,50 +20,84 @@ var templatesFiles embed.FS
 //go:embed static/*
 var staticFiles embed.FS
 
-func main() {
+const usage = `Usage: standwithiran [command] [flags]
 
-	var (
-		tmplFunc server.ExecuteTemplateFunc
-		assets   http.FileSystem
-	)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+Commands:
+  serve         Start the HTTP server (default)
+  migrate       Apply pending database migrations
+  set-password  Set an admin account's password
+  add-user      Create an admin account
+  reset-2fa     Turn off two-factor authentication for an account
+  export        Write the site content as JSON
+  import        Replace the site content from a JSON export
+  check-links   Report links that no longer respond
+  version       Print build information
 
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		dbURL = "postgres://localhost:5432/iran?sslmode=disable"
-	}
+Configuration is read from the environment. Durations are written like
+"6h" or "30s"; "off" or "0" turns the setting off.
 
-	if dbURL == "" {
-		panic("DATABASE_URL is not set")
-	}
+  DATABASE_URL              postgres://, sqlite:// or memory:// URL
+                            (default postgres://localhost:5432/iran?sslmode=disable)
+  PORT                      HTTP port (default 8080)
+  MIGRATE_ON_STARTUP        apply migrations when serving (default true)
+  SESSION_STORE             admin sessions in "database" or "memory"
+                            (default database)
+  TRUSTED_PROXIES           proxy addresses or CIDR ranges whose forwarded
+                            headers are trusted (default none)
+  ANALYTICS_RETENTION_DAYS  days of daily analytics kept (default 90)
+  LINK_CHECK_INTERVAL       how often links are checked (default 6h)
+  LINK_CHECK_FAILURES       failed checks before a link is flagged (default 3)
+  HIDE_BROKEN_LINKS         hide flagged links from the public page
+                            (default false)
+  HSTS_MAX_AGE              Strict-Transport-Security max-age (default 8760h)
+  CSP_REPORT_ONLY           only report Content-Security-Policy violations
+                            (default false)
+  SHUTDOWN_DELAY            time /ready fails before shutting down (default 0)
+  SHUTDOWN_TIMEOUT          time in-flight requests get on shutdown
+                            (default 30s)
+  METRICS_TOKEN             bearer token required for /metrics
+                            (default none, /metrics is open)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+Run "standwithiran <command> -h" for command flags.
+`
+
+func main() {
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	tmpl, err := template.New("").ParseFS(templatesFiles, "templates/*.html")
-	if err != nil {
-		panic(fmt.Errorf("failed to parse templates: %w", err))
+	cfg := config.Load()
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = runServe(cfg, args)
+	case "migrate":
+		err = runMigrate(cfg, args)
+	case "set-password":
+		err = runSetPassword(cfg, args)
+	case "add-user":
+		err = runAddUser(cfg, args)
+	case "reset-2fa":
+		err = runResetTwoFactor(cfg, args)
+	case "export":
+		err = runExport(cfg, args)
+	case "import":
+		err = runImport(cfg, args)
+	case "check-links":
+		err = runCheckLinks(cfg, args)
+	case "version":
+		fmt.Println(server.FormatBuildVersion(version))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
 	}
-	tmplFunc = tmpl.ExecuteTemplate
-	assets = http.FS(staticFiles)
 
-	db, err := database.NewDatabase(ctx, dbURL)
 	if err != nil {
-		panic(fmt.Errorf("failed to initialize database: %w", err))
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+		os.Exit(1)
 	}
-	defer db.Close()
-
-	srv := server.NewServer(version, port, assets, tmplFunc, db)
-
-	go srv.Start()
-	defer srv.Close()
-
-	slog.Info("Started server", slog.String("listen_addr", ":"+port))
-	si := make(chan os.Signal, 1)
-	signal.Notify(si, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-si
-	slog.Info("Shutting down server")
 }
@@ -0,0 +1,9 @@
+-- Aggregate traffic counters. Each row is a single number for one day,
+-- event kind ('view' or 'click') and referring domain ('' for direct).
+CREATE TABLE IF NOT EXISTS analytics_daily (
+    day DATE NOT NULL,
+    kind TEXT NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, kind, referrer)
+);
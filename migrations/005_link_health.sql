@@ -0,0 +1,11 @@
+-- Latest dead-link check per link. failures counts consecutive failed
+-- checks and resets to zero on the first success.
+CREATE TABLE IF NOT EXISTS link_health (
+    link_id TEXT PRIMARY KEY REFERENCES links(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    final_url TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    failures INTEGER NOT NULL DEFAULT 0,
+    checked_at TIMESTAMPTZ NOT NULL
+);
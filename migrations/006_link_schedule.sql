@@ -0,0 +1,3 @@
+-- Optional publishing window. NULL means no limit on that side.
+ALTER TABLE links ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
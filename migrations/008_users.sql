@@ -0,0 +1,15 @@
+-- Per-person admin accounts replace the shared settings.admin_password.
+CREATE TABLE IF NOT EXISTS users (
+    username TEXT PRIMARY KEY,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The shared password becomes the first owner account. It may still be the
+-- plain-text seed from 001_init, which is hashed on first login.
+INSERT INTO users (username, password_hash, role)
+SELECT 'admin', value, 'owner' FROM settings WHERE key = 'admin_password'
+ON CONFLICT (username) DO NOTHING;
+
+DELETE FROM settings WHERE key = 'admin_password';
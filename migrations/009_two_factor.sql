@@ -0,0 +1,10 @@
+-- Optional TOTP second factor. totp_counter is the last time step accepted
+-- so a code can't be replayed within its validity window.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_counter BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    PRIMARY KEY (username, code_hash)
+);
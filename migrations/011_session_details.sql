@@ -0,0 +1,5 @@
+-- Where and when each session was used, for the active sessions page.
+-- address is the client's network (/24 or /48), not its full IP.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS address TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Per-session synchronizer token every admin form must echo back.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS csrf_token TEXT NOT NULL DEFAULT '';
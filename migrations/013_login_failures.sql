@@ -0,0 +1,12 @@
+-- Failed admin sign-ins, kept for owners to review. username is whatever
+-- was typed, so it isn't tied to the users table. reason is "password" or
+-- "code" for a wrong second factor.
+CREATE TABLE IF NOT EXISTS login_failures (
+    username TEXT NOT NULL,
+    address TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_created_at ON login_failures(created_at);
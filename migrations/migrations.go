@@ -0,0 +1,81 @@
+// Package migrations embeds the SQL schema files so the binary can apply
+// them without shipping the migrations directory.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var postgresFiles embed.FS
+
+// The SQLite dialect of the schema, kept equivalent to the Postgres files.
+//
+//go:embed sqlite/*.sql
+var sqliteFiles embed.FS
+
+// Migration is a single versioned schema change. Files are named
+// NNN_description.sql and applied in version order.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Postgres returns the Postgres migrations in version order.
+func Postgres() ([]Migration, error) {
+	return load(postgresFiles, ".")
+}
+
+// SQLite returns the SQLite migrations in version order.
+func SQLite() ([]Migration, error) {
+	return load(sqliteFiles, "sqlite")
+}
+
+// Latest returns the highest version in ms, or 0 if there are none.
+func Latest(ms []Migration) int {
+	if len(ms) == 0 {
+		return 0
+	}
+	return ms[len(ms)-1].Version
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make([]Migration, 0, len(files))
+	seen := make(map[int]string, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNN_description.sql", file)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", file, prefix)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migration %s: version %d already used by %s", file, version, other)
+		}
+		seen[version] = file
+
+		contents, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, Migration{Version: version, Name: name, SQL: string(contents)})
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_later.sql":  {Data: []byte("SELECT 10;")},
+		"002_second.sql": {Data: []byte("SELECT 2;")},
+		"001_first.sql":  {Data: []byte("SELECT 1;")},
+	}
+
+	ms, err := load(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 3 {
+		t.Fatalf("expected 3 migrations, got %d", len(ms))
+	}
+	for i, want := range []int{1, 2, 10} {
+		if ms[i].Version != want {
+			t.Errorf("expected version %d at %d, got %d", want, i, ms[i].Version)
+		}
+	}
+	if ms[0].Name != "001_first" || ms[0].SQL != "SELECT 1;" {
+		t.Errorf("unexpected migration %+v", ms[0])
+	}
+	if Latest(ms) != 10 {
+		t.Errorf("expected latest 10, got %d", Latest(ms))
+	}
+}
+
+func TestLoadRejectsBadNames(t *testing.T) {
+	for _, name := range []string{"init.sql", "abc_init.sql", "000_zero.sql"} {
+		if _, err := load(fstest.MapFS{name: {}}, "."); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+
+	dup := fstest.MapFS{"001_a.sql": {}, "1_b.sql": {}}
+	if _, err := load(dup, "."); err == nil {
+		t.Error("expected duplicate versions to be rejected")
+	}
+}
+
+func TestEmbeddedDialectsMatch(t *testing.T) {
+	pg, err := Postgres()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lite, err := SQLite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg) == 0 || len(pg) != len(lite) {
+		t.Fatalf("expected the same number of migrations per dialect, got %d and %d", len(pg), len(lite))
+	}
+	for i := range pg {
+		if pg[i].Name != lite[i].Name {
+			t.Errorf("migration %d differs between dialects: %s vs %s", i, pg[i].Name, lite[i].Name)
+		}
+	}
+}
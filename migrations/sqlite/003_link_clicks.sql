@@ -0,0 +1,8 @@
+-- Daily click counters per link. Only the count is kept: no IP address,
+-- user agent or other visitor data is ever stored.
+CREATE TABLE IF NOT EXISTS link_clicks (
+    link_id TEXT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, day)
+);
@@ -0,0 +1,3 @@
+-- Optional publishing window. NULL means no limit on that side.
+ALTER TABLE links ADD COLUMN publish_at TIMESTAMP;
+ALTER TABLE links ADD COLUMN expires_at TIMESTAMP;
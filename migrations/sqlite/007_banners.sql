@@ -0,0 +1,13 @@
+-- Scheduled announcement banners. The highest-priority banner whose window
+-- contains the current time is shown; the banner_* settings remain the
+-- fallback when none is active.
+CREATE TABLE IF NOT EXISTS banners (
+    id TEXT PRIMARY KEY,
+    text TEXT NOT NULL,
+    link TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL DEFAULT 'info',
+    priority INTEGER NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
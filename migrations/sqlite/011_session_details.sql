@@ -0,0 +1,5 @@
+-- Where and when each session was used, for the active sessions page.
+-- address is the client's network (/24 or /48), not its full IP.
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN address TEXT NOT NULL DEFAULT '';
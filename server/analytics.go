@@ -0,0 +1,100 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/analytics"
+)
+
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 366
+	// referrerSigSize is how many bytes of the HMAC go on link URLs.
+	referrerSigSize = 12
+)
+
+func newReferrerKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("failed to generate referrer signing key: " + err.Error())
+	}
+	return key
+}
+
+// signReferrer returns the signature the index page puts next to from on
+// link URLs. The key only lives in this process, so clicks on a page served
+// by another replica, or before a restart, count as direct.
+func (s *Server) signReferrer(from string) string {
+	if from == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.referrerKey)
+	mac.Write([]byte(from))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:referrerSigSize])
+}
+
+// clickReferrer returns the referring domain a link click should be counted
+// under: the from parameter if the index page signed it, otherwise "" for
+// direct.
+func (s *Server) clickReferrer(r *http.Request) string {
+	query := r.URL.Query()
+	from := query.Get("from")
+	if from == "" || !hmac.Equal([]byte(query.Get("sig")), []byte(s.signReferrer(from))) {
+		return ""
+	}
+	return analytics.CleanDomain(from, r.Host)
+}
+
+// HandleAnalytics shows daily view and click totals for the last `days`
+// days (default 30). With format=csv the raw day/referrer rows are sent as
+// a download instead.
+func (s *Server) HandleAnalytics(w http.ResponseWriter, r *http.Request) {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = defaultAnalyticsDays
+	}
+	days = min(days, maxAnalyticsDays)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, 1-days)
+
+	rows, err := s.db.GetAnalytics(r.Context(), since.Format(time.DateOnly))
+	if err != nil {
+		slog.Error("Failed to load analytics", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		filename := "analytics-" + today.Format(time.DateOnly) + ".csv"
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"day", "referrer", "views", "clicks"})
+		for _, row := range rows {
+			_ = cw.Write([]string{row.Day, row.Referrer, strconv.Itoa(row.Views), strconv.Itoa(row.Clicks)})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			slog.Error("Failed to write analytics CSV", "error", err)
+		}
+		return
+	}
+
+	data := analytics.Summarize(rows, since, days)
+	data.RetentionDays = s.retentionDays
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "analytics.html", data); err != nil {
+		slog.Error("Failed to render analytics template", "error", err)
+	}
+}
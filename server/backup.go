@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/backup"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+const maxImportSize = 5 << 20
+
+func (s *Server) HandleExport(w http.ResponseWriter, r *http.Request) {
+	doc, err := backup.Export(r.Context(), s.db)
+	if err != nil {
+		slog.Error("Failed to export content", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+export", http.StatusSeeOther)
+		return
+	}
+
+	filename := fmt.Sprintf("standwithiran-%s.json", doc.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if err := backup.Write(w, doc); err != nil {
+		slog.Error("Failed to write export", "error", err)
+	}
+}
+
+// HandleImport previews an uploaded export as a diff against the current
+// content. Submitting the preview form with mode=apply replaces the content.
+func (s *Server) HandleImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	raw, err := readImport(r)
+	if err != nil {
+		http.Redirect(w, r, "/admin?error="+url.QueryEscape("Import failed: "+err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	doc, err := backup.Read(bytes.NewReader(raw))
+	if err != nil {
+		http.Redirect(w, r, "/admin?error="+url.QueryEscape("Import failed: "+err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	if r.FormValue("mode") == "apply" {
+		if err := backup.Import(r.Context(), s.db, doc); err != nil {
+			slog.Error("Failed to import content", "error", err)
+			http.Redirect(w, r, "/admin?error=Import+failed,+nothing+was+changed", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/admin?message=Import+complete", http.StatusSeeOther)
+		return
+	}
+
+	current, err := backup.Load(r.Context(), s.db)
+	if err != nil {
+		slog.Error("Failed to load content", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	data := models.ImportPageData{
+		Diff:      backup.Compare(current, doc.Content()),
+		Document:  string(raw),
+		CSRFToken: currentSession(r).CSRFToken,
+	}
+	if !doc.ExportedAt.IsZero() {
+		data.ExportedAt = doc.ExportedAt.Format(time.RFC1123)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "import.html", data); err != nil {
+		slog.Error("Failed to render import template", "error", err)
+	}
+}
+
+// readImport returns the export document from either the uploaded file or,
+// when confirming a preview, the document field.
+func readImport(r *http.Request) ([]byte, error) {
+	if doc := r.FormValue("document"); strings.TrimSpace(doc) != "" {
+		return []byte(doc), nil
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("no file uploaded")
+	}
+	defer func() { _ = file.Close() }()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/urlpolicy"
+)
+
+// HandleBanners lists scheduled banners grouped into active, upcoming and
+// past, next to a form for queueing a new one.
+func (s *Server) HandleBanners(w http.ResponseWriter, r *http.Request) {
+	banners, err := s.db.GetScheduledBanners(r.Context())
+	if err != nil {
+		slog.Error("Failed to load scheduled banners", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+	fallback, err := s.db.GetBanner(r.Context())
+	if err != nil {
+		slog.Error("Failed to load banner", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	data := groupBanners(banners, time.Now())
+	data.Fallback = fallback
+	data.User = currentUser(r)
+	data.CSRFToken = currentSession(r).CSRFToken
+	data.Message = r.URL.Query().Get("message")
+	data.Error = r.URL.Query().Get("error")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "banners.html", data); err != nil {
+		slog.Error("Failed to render banners template", "error", err)
+	}
+}
+
+func groupBanners(banners []models.ScheduledBanner, now time.Time) models.BannersPageData {
+	var data models.BannersPageData
+	for _, b := range banners {
+		switch b.Status(now) {
+		case models.BannerActive:
+			data.Active = append(data.Active, b)
+		case models.BannerUpcoming:
+			data.Upcoming = append(data.Upcoming, b)
+		default:
+			data.Past = append(data.Past, b)
+		}
+	}
+
+	// Active in the order they win, upcoming soonest first, past most
+	// recently ended first
+	sort.SliceStable(data.Active, func(i, j int) bool {
+		a, b := data.Active[i], data.Active[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.StartsAt != nil && (b.StartsAt == nil || a.StartsAt.After(*b.StartsAt))
+	})
+	sort.SliceStable(data.Upcoming, func(i, j int) bool {
+		return data.Upcoming[i].StartsAt.Before(*data.Upcoming[j].StartsAt)
+	})
+	sort.SliceStable(data.Past, func(i, j int) bool {
+		return data.Past[i].EndsAt.After(*data.Past[j].EndsAt)
+	})
+	return data
+}
+
+func (s *Server) HandleAddBanner(w http.ResponseWriter, r *http.Request) {
+	banner := models.ScheduledBanner{
+		Text: strings.TrimSpace(r.FormValue("text")),
+		Link: strings.TrimSpace(r.FormValue("link")),
+		Type: r.FormValue("type"),
+	}
+
+	if banner.Text == "" {
+		http.Redirect(w, r, "/admin/banners?error=Banner+text+is+required", http.StatusSeeOther)
+		return
+	}
+	if !slices.Contains(models.BannerTypes, banner.Type) {
+		http.Redirect(w, r, "/admin/banners?error=Invalid+banner+style", http.StatusSeeOther)
+		return
+	}
+	if p := strings.TrimSpace(r.FormValue("priority")); p != "" {
+		priority, err := strconv.Atoi(p)
+		if err != nil {
+			http.Redirect(w, r, "/admin/banners?error=Priority+must+be+a+number", http.StatusSeeOther)
+			return
+		}
+		banner.Priority = priority
+	}
+
+	var err error
+	if banner.Link, err = optionalURL(urlpolicy.Link, banner.Link); err != nil {
+		http.Redirect(w, r, "/admin/banners?error="+urlErrorMessage("Link", err), http.StatusSeeOther)
+		return
+	}
+	if banner.StartsAt, err = formTime(r, "starts_at"); err != nil {
+		http.Redirect(w, r, "/admin/banners?error=Invalid+start+time", http.StatusSeeOther)
+		return
+	}
+	if banner.EndsAt, err = formTime(r, "ends_at"); err != nil {
+		http.Redirect(w, r, "/admin/banners?error=Invalid+end+time", http.StatusSeeOther)
+		return
+	}
+	if banner.StartsAt != nil && banner.EndsAt != nil && !banner.EndsAt.After(*banner.StartsAt) {
+		http.Redirect(w, r, "/admin/banners?error=End+time+must+be+after+the+start+time", http.StatusSeeOther)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		slog.Error("Failed to generate random ID", "error", err)
+		http.Redirect(w, r, "/admin/banners?error=Failed+to+generate+ID", http.StatusSeeOther)
+		return
+	}
+	banner.ID = id
+
+	if err := s.db.AddScheduledBanner(r.Context(), banner); err != nil {
+		slog.Error("Failed to add banner", "error", err)
+		http.Redirect(w, r, "/admin/banners?error=Failed+to+save+banner", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/banners?message=Banner+scheduled", http.StatusSeeOther)
+}
+
+func (s *Server) HandleDeleteBanner(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteScheduledBanner(r.Context(), r.FormValue("id")); err != nil {
+		slog.Error("Failed to delete banner", "error", err)
+		http.Redirect(w, r, "/admin/banners?error=Failed+to+delete+banner", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/banners?message=Banner+deleted", http.StatusSeeOther)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	// csrfField is the hidden form field carrying the session's CSRF token.
+	csrfField = "csrf_token"
+	// csrfHeader lets scripts send the token without a form body.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// VerifyCSRF rejects state-changing requests that don't echo the session's
+// CSRF token, so another site can't post forms with an admin's cookie. It
+// must run after RequireAuth.
+//
+// The body is capped at maxImportSize here, since parsing the form to find
+// the token reads uploads before the handler can limit them.
+func (s *Server) VerifyCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		err := r.ParseMultipartForm(maxImportSize)
+		if errors.Is(err, http.ErrNotMultipart) {
+			err = nil
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.renderErrorMessage(w, http.StatusRequestEntityTooLarge, "That upload is too large.")
+			return
+		}
+		if err != nil {
+			s.renderErrorMessage(w, http.StatusBadRequest, "The form couldn't be read.")
+			return
+		}
+
+		token := r.Header.Get(csrfHeader)
+		if token == "" {
+			token = r.PostFormValue(csrfField)
+		}
+		want := currentSession(r).CSRFToken
+		if want == "" || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			slog.Warn("Rejected request with invalid CSRF token", "path", r.URL.Path, "user", currentUser(r).Username)
+			s.renderErrorMessage(w, http.StatusForbidden, "This form has expired or didn't come from this site. Go back, reload the page and try again.")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,19 +3,39 @@ package server
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+
+	"github.com/alexraskin/standwithiran/internal/analytics"
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/linkcheck"
+	"github.com/alexraskin/standwithiran/internal/linkcsv"
 	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/urlpolicy"
 )
 
 func (s *Server) renderError(w http.ResponseWriter, status int) {
+	s.renderErrorMessage(w, status, "We're having trouble right now. Please try again in a moment.")
+}
+
+func (s *Server) renderErrorMessage(w http.ResponseWriter, status int, message string) {
+	title := "Something Went Wrong"
+	if status < http.StatusInternalServerError {
+		title = http.StatusText(status)
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(status)
-	if err := s.tmplFunc(w, "error.html", nil); err != nil {
+	data := models.ErrorPageData{Status: status, Title: title, Message: message}
+	if err := s.tmplFunc(w, "error.html", data); err != nil {
 		slog.Error("Failed to render error template", "error", err)
 	}
 }
@@ -36,13 +56,28 @@ func (s *Server) HandleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	banner, _ := s.db.GetBanner(r.Context())
+	// Filtering here rather than in the query keeps cached link lists from
+	// showing a link past its expiry.
+	links = models.LiveLinks(links, time.Now())
+	if s.hideBroken {
+		links = s.withoutBroken(r, links)
+	}
+
+	banner := s.currentBanner(r)
+
+	from := analytics.ReferrerDomain(r.Referer(), r.Host)
+	if !analytics.IsBot(r.UserAgent()) {
+		s.analytics.PageView(from)
+	}
 
 	data := models.IndexPageData{
 		Profile:     profile,
 		Links:       links,
 		Banner:      banner,
 		LastUpdated: time.Now().Format("Jan 2, 2006"),
+		From:        from,
+		FromSig:     s.signReferrer(from),
+		Nonce:       cspNonce(r),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -51,9 +86,54 @@ func (s *Server) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// currentBanner returns the highest-priority scheduled banner active now,
+// falling back to the default banner from the settings.
+func (s *Server) currentBanner(r *http.Request) models.Banner {
+	banners, err := s.db.GetScheduledBanners(r.Context())
+	if err != nil {
+		slog.Error("Failed to load scheduled banners", "error", err)
+	}
+	if b, ok := models.ActiveBanner(banners, time.Now()); ok {
+		return b.Banner()
+	}
+
+	banner, _ := s.db.GetBanner(r.Context())
+	return banner
+}
+
+// HandleLinkRedirect counts a click on a link and sends the visitor on to
+// its URL. Only per-day counters are recorded.
+func (s *Server) HandleLinkRedirect(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	links, err := s.db.GetLinks(r.Context())
+	if err != nil {
+		slog.Error("Failed to load links", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	for _, l := range links {
+		if l.ID != id || l.Status(time.Now()) != models.LinkLive {
+			continue
+		}
+		if err := s.db.RecordClick(r.Context(), id); err != nil {
+			slog.Error("Failed to record click", "error", err)
+		}
+		if !analytics.IsBot(r.UserAgent()) {
+			s.analytics.Click(s.clickReferrer(r))
+		}
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		http.Redirect(w, r, l.URL, http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
 func (s *Server) HandleLoginPage(w http.ResponseWriter, r *http.Request) {
 	token := s.getSessionFromRequest(r)
-	if s.validateSession(token) {
+	if s.validateSession(r.Context(), token) {
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 		return
 	}
@@ -65,39 +145,43 @@ func (s *Server) HandleLoginPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	username := strings.ToLower(strings.TrimSpace(r.FormValue("username")))
 	password := r.FormValue("password")
 
-	valid, err := s.db.VerifyPassword(r.Context(), password)
-	if err != nil {
-		slog.Error("Failed to verify password", "error", err)
-		s.renderError(w, http.StatusInternalServerError)
+	if wait, locked := s.loginWait(r, username); wait > 0 {
+		s.renderLoginThrottled(w, "login.html", username, wait, locked)
 		return
 	}
 
-	if !valid {
+	user, err := s.db.AuthenticateUser(r.Context(), username, password)
+	if errors.Is(err, database.ErrInvalidCredentials) {
+		s.loginFailed(r, username, models.LoginFailurePassword)
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if err := s.tmplFunc(w, "login.html", map[string]string{"Error": "Invalid password"}); err != nil {
+		data := map[string]string{"Error": "Invalid username or password", "Username": username}
+		if err := s.tmplFunc(w, "login.html", data); err != nil {
 			slog.Error("Failed to render login template", "error", err)
 		}
 		return
 	}
+	if err != nil {
+		slog.Error("Failed to verify password", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
 
-	token := s.createSession()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   86400,
-		SameSite: http.SameSiteStrictMode,
-	})
-
-	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	// With two-factor on, failures are only forgotten once the code is
+	// right too, so knowing the password doesn't buy unlimited code guesses
+	if user.TwoFactor {
+		s.startSecondFactor(w, r, user.Username)
+		return
+	}
+	s.loginSucceeded(r, username)
+	s.startSession(w, r, user.Username)
 }
 
 func (s *Server) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	token := s.getSessionFromRequest(r)
-	s.deleteSession(token)
+	s.deleteSession(r.Context(), token)
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session",
@@ -111,70 +195,204 @@ func (s *Server) HandleLogout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) HandleAdmin(w http.ResponseWriter, r *http.Request) {
-	message := r.URL.Query().Get("message")
-	errorMsg := r.URL.Query().Get("error")
+	data, err := s.adminPageData(r)
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	s.renderAdmin(w, data)
+}
 
+func (s *Server) adminPageData(r *http.Request) (models.AdminPageData, error) {
 	profile, err := s.db.GetProfile(r.Context())
 	if err != nil {
 		slog.Error("Failed to load profile", "error", err)
-		s.renderError(w, http.StatusInternalServerError)
-		return
+		return models.AdminPageData{}, err
 	}
 	links, err := s.db.GetLinks(r.Context())
 	if err != nil {
 		slog.Error("Failed to load links", "error", err)
-		s.renderError(w, http.StatusInternalServerError)
-		return
+		return models.AdminPageData{}, err
 	}
 	banner, err := s.db.GetBanner(r.Context())
 	if err != nil {
 		slog.Error("Failed to load banner", "error", err)
-		s.renderError(w, http.StatusInternalServerError)
-		return
+		return models.AdminPageData{}, err
+	}
+	clicks, err := s.db.GetClickCounts(r.Context())
+	if err != nil {
+		slog.Error("Failed to load click counts", "error", err)
+		return models.AdminPageData{}, err
 	}
+	health, err := s.db.GetLinkHealth(r.Context())
+	if err != nil {
+		slog.Error("Failed to load link health", "error", err)
+		return models.AdminPageData{}, err
+	}
+
+	return models.AdminPageData{
+		Profile:    profile,
+		Links:      links,
+		Banner:     banner,
+		Clicks:     clicks,
+		Broken:     linkcheck.Broken(links, health, s.brokenAfter),
+		HideBroken: s.hideBroken,
+		Now:        time.Now(),
+		Categories: categoryOptions(),
+		Icons:      iconOptions(),
+		User:       currentUser(r),
+		CSRFToken:  currentSession(r).CSRFToken,
+		Nonce:      cspNonce(r),
+		Message:    r.URL.Query().Get("message"),
+		Error:      r.URL.Query().Get("error"),
+	}, nil
+}
 
-	data := models.AdminPageData{
-		Profile: profile,
-		Links:   links,
-		Banner:  banner,
-		Message: message,
-		Error:   errorMsg,
+// withoutBroken drops links flagged by the dead-link checker. If the check
+// results cannot be loaded every link is kept.
+func (s *Server) withoutBroken(r *http.Request, links []models.Link) []models.Link {
+	health, err := s.db.GetLinkHealth(r.Context())
+	if err != nil {
+		slog.Error("Failed to load link health", "error", err)
+		return links
+	}
+	broken := linkcheck.Broken(links, health, s.brokenAfter)
+	if len(broken) == 0 {
+		return links
 	}
 
+	visible := make([]models.Link, 0, len(links)-len(broken))
+	for _, l := range links {
+		if _, ok := broken[l.ID]; !ok {
+			visible = append(visible, l)
+		}
+	}
+	return visible
+}
+
+func (s *Server) renderAdmin(w http.ResponseWriter, data models.AdminPageData) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := s.tmplFunc(w, "admin.html", data); err != nil {
 		slog.Error("Failed to render admin template", "error", err)
 	}
 }
 
-func (s *Server) HandleAddLink(w http.ResponseWriter, r *http.Request) {
-	title := r.FormValue("title")
-	url := r.FormValue("url")
-	category := r.FormValue("category")
-	icon := r.FormValue("icon")
-	featured := r.FormValue("featured") == "true"
+// categoryOptions and iconOptions build the link form's choices from the
+// same lists linkFromForm accepts.
+func categoryOptions() []models.Option {
+	options := make([]models.Option, len(models.Categories))
+	for i, c := range models.Categories {
+		options[i] = models.Option{Value: c, Label: capitalize(c)}
+	}
+	return options
+}
+
+func iconOptions() []models.Option {
+	options := make([]models.Option, len(models.Icons))
+	for i, icon := range models.Icons {
+		options[i] = models.Option{Value: icon, Label: models.IconEmoji[icon] + " " + capitalize(icon)}
+	}
+	return options
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// linkFromForm reads the link fields shared by the add and edit forms. The
+// second return value is a URL-encoded error message for the admin redirect,
+// empty when the submission is valid.
+func linkFromForm(r *http.Request) (models.Link, string) {
+	link := models.Link{
+		Title:    strings.TrimSpace(r.FormValue("title")),
+		URL:      strings.TrimSpace(r.FormValue("url")),
+		Category: r.FormValue("category"),
+		Icon:     r.FormValue("icon"),
+		Featured: r.FormValue("featured") == "true",
+	}
+
+	if link.Title == "" || link.URL == "" {
+		return link, "Title+and+URL+are+required"
+	}
 
-	if title == "" || url == "" {
-		http.Redirect(w, r, "/admin?error=Title+and+URL+are+required", http.StatusSeeOther)
+	// Same rules as the CSV import
+	if link.Category == "" {
+		link.Category = models.DefaultCategory
+	}
+	if !slices.Contains(models.Categories, link.Category) {
+		return link, "Unknown+category"
+	}
+	if link.Icon == "" {
+		link.Icon = models.DefaultIcon
+	}
+	if !slices.Contains(models.Icons, link.Icon) {
+		return link, "Unknown+icon"
+	}
+
+	policy := urlpolicy.Link
+	policy.StripTracking = r.FormValue("strip_tracking") == "true"
+	var err error
+	if link.URL, err = policy.Normalize(link.URL); err != nil {
+		return link, urlErrorMessage("URL", err)
+	}
+	if link.PublishAt, err = formTime(r, "publish_at"); err != nil {
+		return link, "Invalid+publish+date"
+	}
+	if link.ExpiresAt, err = formTime(r, "expires_at"); err != nil {
+		return link, "Invalid+expiry+date"
+	}
+	if link.PublishAt != nil && link.ExpiresAt != nil && !link.ExpiresAt.After(*link.PublishAt) {
+		return link, "Expiry+must+be+after+the+publish+date"
+	}
+
+	return link, ""
+}
+
+// urlErrorMessage is the URL-encoded redirect message for a field that
+// failed the URL policy.
+func urlErrorMessage(field string, err error) string {
+	return url.QueryEscape(field + ": " + err.Error())
+}
+
+// optionalURL normalizes a URL field that may be left empty.
+func optionalURL(policy urlpolicy.Policy, value string) (string, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return "", nil
+	}
+	return policy.Normalize(value)
+}
+
+// formTime parses an optional datetime-local field as UTC.
+func formTime(r *http.Request, field string) (*time.Time, error) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02T15:04", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Server) HandleAddLink(w http.ResponseWriter, r *http.Request) {
+	link, errMsg := linkFromForm(r)
+	if errMsg != "" {
+		http.Redirect(w, r, "/admin?error="+errMsg, http.StatusSeeOther)
 		return
 	}
 
-	bytes := make([]byte, 8)
-	if _, err := rand.Read(bytes); err != nil {
+	id, err := newID()
+	if err != nil {
 		slog.Error("Failed to generate random ID", "error", err)
 		http.Redirect(w, r, "/admin?error=Failed+to+generate+ID", http.StatusSeeOther)
 		return
 	}
-	id := hex.EncodeToString(bytes)
-
-	link := models.Link{
-		ID:       id,
-		Title:    title,
-		URL:      url,
-		Category: category,
-		Icon:     icon,
-		Featured: featured,
-	}
+	link.ID = id
 
 	if err := s.db.AddLink(r.Context(), link); err != nil {
 		slog.Error("Failed to add link", "error", err)
@@ -185,6 +403,115 @@ func (s *Server) HandleAddLink(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin?message=Link+added+successfully", http.StatusSeeOther)
 }
 
+func newID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// HandleImportLinksCSV bulk-adds links from an uploaded spreadsheet. Valid
+// rows are inserted together; rejected rows are listed on the result page.
+func (s *Server) HandleImportLinksCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Redirect(w, r, "/admin?error=No+CSV+file+uploaded", http.StatusSeeOther)
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	existing, err := s.db.GetLinks(r.Context())
+	if err != nil {
+		slog.Error("Failed to load links", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+import", http.StatusSeeOther)
+		return
+	}
+
+	links, rowErrs, err := linkcsv.Parse(file, existing)
+	if err != nil {
+		http.Redirect(w, r, "/admin?error="+url.QueryEscape("CSV import failed: "+err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	for i := range links {
+		id, err := newID()
+		if err != nil {
+			slog.Error("Failed to generate random ID", "error", err)
+			http.Redirect(w, r, "/admin?error=Failed+to+generate+ID", http.StatusSeeOther)
+			return
+		}
+		links[i].ID = id
+	}
+
+	if len(links) > 0 {
+		if err := s.db.AddLinks(r.Context(), links); err != nil {
+			slog.Error("Failed to add links", "error", err)
+			http.Redirect(w, r, "/admin?error=Failed+to+save,+no+links+were+added", http.StatusSeeOther)
+			return
+		}
+	}
+
+	data := models.CSVImportPageData{
+		Added:  links,
+		Errors: rowErrs,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "links_import.html", data); err != nil {
+		slog.Error("Failed to render links import template", "error", err)
+	}
+}
+
+func (s *Server) HandleEditLinkPage(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	data, err := s.adminPageData(r)
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	for i := range data.Links {
+		if data.Links[i].ID == id {
+			link := data.Links[i]
+			data.EditLink = &link
+			break
+		}
+	}
+	if data.EditLink == nil {
+		http.Redirect(w, r, "/admin?error=Link+not+found", http.StatusSeeOther)
+		return
+	}
+
+	s.renderAdmin(w, data)
+}
+
+func (s *Server) HandleEditLink(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+
+	link, errMsg := linkFromForm(r)
+	if errMsg != "" {
+		http.Redirect(w, r, "/admin/links/edit?id="+url.QueryEscape(id)+"&error="+errMsg, http.StatusSeeOther)
+		return
+	}
+	link.ID = id
+
+	if err := s.db.UpdateLink(r.Context(), link); err != nil {
+		if errors.Is(err, database.ErrLinkNotFound) {
+			http.Redirect(w, r, "/admin?error=Link+not+found", http.StatusSeeOther)
+			return
+		}
+		slog.Error("Failed to update link", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+save", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin?message=Link+updated", http.StatusSeeOther)
+}
+
 func (s *Server) HandleDeleteLink(w http.ResponseWriter, r *http.Request) {
 	id := r.FormValue("id")
 
@@ -210,6 +537,92 @@ func (s *Server) HandleToggleFeatured(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin?message=Link+updated", http.StatusSeeOther)
 }
 
+func (s *Server) HandleMoveLink(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	direction := r.FormValue("direction")
+
+	links, err := s.db.GetLinks(r.Context())
+	if err != nil {
+		slog.Error("Failed to load links", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+update", http.StatusSeeOther)
+		return
+	}
+
+	ids := make([]string, len(links))
+	index := -1
+	for i, l := range links {
+		ids[i] = l.ID
+		if l.ID == id {
+			index = i
+		}
+	}
+	if index == -1 {
+		http.Redirect(w, r, "/admin?error=Link+not+found", http.StatusSeeOther)
+		return
+	}
+
+	target := index - 1
+	if direction == "down" {
+		target = index + 1
+	}
+	// Featured links are always listed first, so a move only makes sense
+	// between neighbours in the same group.
+	if target < 0 || target >= len(links) || links[target].Featured != links[index].Featured {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	ids[index], ids[target] = ids[target], ids[index]
+
+	if err := s.db.ReorderLinks(r.Context(), ids); err != nil {
+		slog.Error("Failed to reorder links", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+update", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin?message=Link+moved", http.StatusSeeOther)
+}
+
+func (s *Server) HandleReorderLinks(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Redirect(w, r, "/admin?error=Invalid+request", http.StatusSeeOther)
+		return
+	}
+	ids := r.PostForm["id"]
+
+	links, err := s.db.GetLinks(r.Context())
+	if err != nil {
+		slog.Error("Failed to load links", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+update", http.StatusSeeOther)
+		return
+	}
+
+	// The submitted ordering must name every existing link exactly once;
+	// anything else means the page is stale.
+	known := make(map[string]bool, len(links))
+	for _, l := range links {
+		known[l.ID] = true
+	}
+	if len(ids) != len(links) {
+		http.Redirect(w, r, "/admin?error=Links+changed,+please+reload+and+try+again", http.StatusSeeOther)
+		return
+	}
+	for _, id := range ids {
+		if !known[id] {
+			http.Redirect(w, r, "/admin?error=Links+changed,+please+reload+and+try+again", http.StatusSeeOther)
+			return
+		}
+		delete(known, id)
+	}
+
+	if err := s.db.ReorderLinks(r.Context(), ids); err != nil {
+		slog.Error("Failed to reorder links", "error", err)
+		http.Redirect(w, r, "/admin?error=Failed+to+update", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin?message=Link+order+saved", http.StatusSeeOther)
+}
+
 func (s *Server) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 	profile := models.Profile{
 		Name:        r.FormValue("name"),
@@ -219,6 +632,12 @@ func (s *Server) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 		Avatar:      r.FormValue("avatar"),
 	}
 
+	var err error
+	if profile.Avatar, err = optionalURL(urlpolicy.Image, profile.Avatar); err != nil {
+		http.Redirect(w, r, "/admin?error="+urlErrorMessage("Avatar", err), http.StatusSeeOther)
+		return
+	}
+
 	if err := s.db.UpdateProfile(r.Context(), profile); err != nil {
 		slog.Error("Failed to update profile", "error", err)
 		http.Redirect(w, r, "/admin?error=Failed+to+save", http.StatusSeeOther)
@@ -231,17 +650,22 @@ func (s *Server) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 func (s *Server) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
 	newPassword := r.FormValue("new_password")
 
-	if len(newPassword) < 6 {
-		http.Redirect(w, r, "/admin?error=Password+must+be+at+least+6+characters", http.StatusSeeOther)
+	if len(newPassword) < MinPasswordLength {
+		http.Redirect(w, r, "/admin?error="+passwordTooShort, http.StatusSeeOther)
 		return
 	}
 
-	if err := s.db.SetPassword(r.Context(), newPassword); err != nil {
+	username := currentUser(r).Username
+	if err := s.db.SetUserPassword(r.Context(), username, newPassword); err != nil {
 		slog.Error("Failed to update password", "error", err)
 		http.Redirect(w, r, "/admin?error=Failed+to+save", http.StatusSeeOther)
 		return
 	}
 
+	if s.revokeOtherSessions(r, username) > 0 {
+		http.Redirect(w, r, "/admin?message=Password+updated,+your+other+sessions+were+signed+out", http.StatusSeeOther)
+		return
+	}
 	http.Redirect(w, r, "/admin?message=Password+updated", http.StatusSeeOther)
 }
 
@@ -253,6 +677,12 @@ func (s *Server) HandleUpdateBanner(w http.ResponseWriter, r *http.Request) {
 		Type:    r.FormValue("banner_type"),
 	}
 
+	var err error
+	if banner.Link, err = optionalURL(urlpolicy.Link, banner.Link); err != nil {
+		http.Redirect(w, r, "/admin?error="+urlErrorMessage("Banner link", err), http.StatusSeeOther)
+		return
+	}
+
 	if err := s.db.UpdateBanner(r.Context(), banner); err != nil {
 		slog.Error("Failed to update banner", "error", err)
 		http.Redirect(w, r, "/admin?error=Failed+to+save+banner", http.StatusSeeOther)
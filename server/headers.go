@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// cspReportPath receives Content-Security-Policy violation reports.
+	cspReportPath = "/csp-report"
+	// maxCSPReportSize caps a report body; real reports are a few hundred
+	// bytes.
+	maxCSPReportSize = 64 << 10
+	// maxCSPReportsLogged is how many reports from one batch are logged.
+	maxCSPReportsLogged = 10
+	// maxCSPReportField cuts long report values, such as the page's whole
+	// policy, down before they are logged.
+	maxCSPReportField = 256
+)
+
+// SetSecurityHeaders sets how long browsers are told to insist on HTTPS
+// (zero sends no Strict-Transport-Security header) and whether the
+// Content-Security-Policy only reports violations instead of blocking them.
+func (s *Server) SetSecurityHeaders(hstsMaxAge time.Duration, cspReportOnly bool) {
+	s.hstsMaxAge = hstsMaxAge
+	s.cspReportOnly = cspReportOnly
+}
+
+// securityHeaders sets the browser hardening headers on every response and
+// gives each request a fresh nonce for the Content-Security-Policy. Scripts
+// only run from tags carrying the nonce, so templates must not use inline
+// event handlers or style attributes.
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := newNonce()
+
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=(), usb=(), browsing-topics=()")
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		h.Set("Reporting-Endpoints", `csp="`+cspReportPath+`"`)
+		if s.cspReportOnly {
+			h.Set("Content-Security-Policy-Report-Only", contentSecurityPolicy(nonce))
+		} else {
+			h.Set("Content-Security-Policy", contentSecurityPolicy(nonce))
+		}
+		if s.hstsMaxAge > 0 {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(s.hstsMaxAge/time.Second)))
+		}
+
+		ctx := context.WithValue(r.Context(), nonceContextKey, nonce)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// contentSecurityPolicy allows scripts only from tags carrying nonce and
+// everything else only from this site, except images: the avatar may be
+// hosted anywhere and the two-factor QR code is a data URL.
+func contentSecurityPolicy(nonce string) string {
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src 'nonce-" + nonce + "' 'strict-dynamic'",
+		"style-src 'self' 'nonce-" + nonce + "'",
+		"img-src 'self' data: https:",
+		"font-src 'self'",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'none'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+		"report-uri " + cspReportPath,
+		"report-to csp",
+	}, "; ")
+}
+
+func newNonce() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic("failed to generate CSP nonce: " + err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(bytes)
+}
+
+// cspNonce returns the nonce securityHeaders put in the request's policy.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceContextKey).(string)
+	return nonce
+}
+
+// cspViolation is the part of a violation report worth logging.
+type cspViolation struct {
+	Document    string
+	Directive   string
+	Blocked     string
+	Source      string
+	Line        int
+	Sample      string
+	Disposition string
+}
+
+// HandleCSPReport logs violation reports sent by browsers, either in the
+// older report-uri format or as a Reporting API batch.
+func (s *Server) HandleCSPReport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+	if err != nil {
+		http.Error(w, "Report too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	violations, err := parseCSPReports(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+
+	for i, v := range violations {
+		if i == maxCSPReportsLogged {
+			slog.Warn("Dropped further CSP violation reports", "count", len(violations)-i)
+			break
+		}
+		slog.Warn("CSP violation",
+			"document", v.Document,
+			"directive", v.Directive,
+			"blocked", v.Blocked,
+			"source", v.Source,
+			"line", v.Line,
+			"sample", v.Sample,
+			"disposition", v.Disposition,
+			"user_agent", userAgent(r),
+		)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseCSPReports reads a report body. report-uri posts a single
+// {"csp-report": {...}} object as application/csp-report; report-to posts
+// an array of reports as application/reports+json.
+func parseCSPReports(contentType string, body []byte) ([]cspViolation, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/reports+json":
+		var reports []struct {
+			Type string `json:"type"`
+			Body struct {
+				DocumentURL        string `json:"documentURL"`
+				EffectiveDirective string `json:"effectiveDirective"`
+				BlockedURL         string `json:"blockedURL"`
+				SourceFile         string `json:"sourceFile"`
+				LineNumber         int    `json:"lineNumber"`
+				Sample             string `json:"sample"`
+				Disposition        string `json:"disposition"`
+			} `json:"body"`
+		}
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+		var violations []cspViolation
+		for _, rep := range reports {
+			if rep.Type != "csp-violation" {
+				continue
+			}
+			violations = append(violations, newCSPViolation(rep.Body.DocumentURL, rep.Body.EffectiveDirective,
+				rep.Body.BlockedURL, rep.Body.SourceFile, rep.Body.LineNumber, rep.Body.Sample, rep.Body.Disposition))
+		}
+		return violations, nil
+
+	case "application/csp-report", "application/json":
+		var report struct {
+			Report *struct {
+				DocumentURI        string `json:"document-uri"`
+				ViolatedDirective  string `json:"violated-directive"`
+				EffectiveDirective string `json:"effective-directive"`
+				BlockedURI         string `json:"blocked-uri"`
+				SourceFile         string `json:"source-file"`
+				LineNumber         int    `json:"line-number"`
+				ScriptSample       string `json:"script-sample"`
+				Disposition        string `json:"disposition"`
+			} `json:"csp-report"`
+		}
+		if err := json.Unmarshal(body, &report); err != nil {
+			return nil, err
+		}
+		if report.Report == nil {
+			return nil, errors.New("missing csp-report")
+		}
+		rep := report.Report
+		directive := rep.EffectiveDirective
+		if directive == "" {
+			directive = rep.ViolatedDirective
+		}
+		return []cspViolation{newCSPViolation(rep.DocumentURI, directive, rep.BlockedURI,
+			rep.SourceFile, rep.LineNumber, rep.ScriptSample, rep.Disposition)}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+}
+
+func newCSPViolation(document, directive, blocked, source string, line int, sample, disposition string) cspViolation {
+	return cspViolation{
+		Document:    truncateReportField(document),
+		Directive:   truncateReportField(directive),
+		Blocked:     truncateReportField(blocked),
+		Source:      truncateReportField(source),
+		Line:        line,
+		Sample:      truncateReportField(sample),
+		Disposition: truncateReportField(disposition),
+	}
+}
+
+// truncateReportField keeps attacker-supplied report values from bloating
+// the log.
+func truncateReportField(value string) string {
+	if len(value) > maxCSPReportField {
+		return strings.ToValidUTF8(value[:maxCSPReportField], "")
+	}
+	return value
+}
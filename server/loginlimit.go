@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+// loginFailuresShown is how many recent failures the review page lists.
+const loginFailuresShown = 200
+
+// clientIP returns the address realIP resolved for the request, without a
+// port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// loginWait reports how long until username may be tried again from the
+// client's address, and whether the address is locked out rather than just
+// slowed down. The address limit stops one machine spraying passwords across
+// accounts; the account limit stops many machines sharing the guessing.
+func (s *Server) loginWait(r *http.Request, username string) (time.Duration, bool) {
+	ip := "ip:" + clientIP(r)
+	return max(s.logins.Wait(ip), s.accounts.Wait("user:"+username)), s.logins.Locked(ip)
+}
+
+// loginSucceeded forgets the failures of the address and account.
+func (s *Server) loginSucceeded(r *http.Request, username string) {
+	s.logins.Reset("ip:" + clientIP(r))
+	s.accounts.Reset("user:" + username)
+}
+
+// loginFailed slows down further attempts and records the failure for
+// owners to review.
+func (s *Server) loginFailed(r *http.Request, username, reason string) {
+	s.logins.Fail("ip:" + clientIP(r))
+	s.accounts.Fail("user:" + username)
+
+	// The username is whatever was typed; don't let it bloat the log
+	if len(username) > 64 {
+		username = strings.ToValidUTF8(username[:64], "")
+	}
+	slog.Warn("Failed login", "user", username, "address", clientIP(r), "reason", reason)
+	err := s.db.RecordLoginFailure(r.Context(), models.LoginFailure{
+		Username:  username,
+		Address:   clientIP(r),
+		UserAgent: userAgent(r),
+		Reason:    reason,
+		At:        time.Now(),
+	})
+	if err != nil {
+		slog.Error("Failed to record login failure", "error", err)
+	}
+}
+
+// renderLoginThrottled answers an attempt made before the limiter's wait is
+// up without checking the password or code. A lockout gets its own message
+// so nobody keeps retrying every few seconds for a quarter of an hour.
+func (s *Server) renderLoginThrottled(w http.ResponseWriter, name, username string, wait time.Duration, locked bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	data := map[string]string{"Username": username}
+	if locked {
+		data["Locked"] = "Sign-in is locked after too many failed attempts. Try again in " + formatWait(wait) + "."
+	} else {
+		data["Throttled"] = "Too many failed sign-ins. Wait " + formatWait(wait) + " before trying again."
+	}
+	if err := s.tmplFunc(w, name, data); err != nil {
+		slog.Error("Failed to render login template", "error", err)
+	}
+}
+
+// formatWait rounds wait up to whole seconds or minutes.
+func formatWait(wait time.Duration) string {
+	if wait > time.Minute {
+		return plural(int((wait+time.Minute-1)/time.Minute), "minute")
+	}
+	return plural(int((wait+time.Second-1)/time.Second), "second")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+func (s *Server) HandleLoginFailures(w http.ResponseWriter, r *http.Request) {
+	failures, err := s.db.GetLoginFailures(r.Context(), loginFailuresShown)
+	if err != nil {
+		slog.Error("Failed to load login failures", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	data := models.LoginFailuresPageData{
+		User:     currentUser(r),
+		Failures: failures,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "login_failures.html", data); err != nil {
+		slog.Error("Failed to render login failures template", "error", err)
+	}
+}
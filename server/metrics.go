@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "standwithiran"
+	// sessionCountTimeout bounds the session lookup done on every scrape.
+	sessionCountTimeout = 2 * time.Second
+)
+
+type metrics struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_info",
+		Help:      "Always 1, labelled with the running build.",
+	}, []string{"version", "go_version"})
+	buildInfo.WithLabelValues(s.version, runtime.Version()).Set(1)
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		buildInfo,
+		newServerCollector(s),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// SetMetricsToken requires scrapes of /metrics to send the token as a
+// bearer token. An empty token leaves the endpoint open.
+func (s *Server) SetMetricsToken(token string) {
+	s.metricsToken = token
+}
+
+// instrument counts and times requests by the chi route pattern they
+// matched, so /go/{id} is one series rather than one per link.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// Count the request before passing a panic on to Recoverer
+			rec := recover()
+			if rec != nil {
+				status = http.StatusInternalServerError
+			}
+
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := metricMethod(r.Method)
+			s.metrics.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			s.metrics.duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// metricMethod keeps made-up request methods from adding label values.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+func (s *Server) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.metricsToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.metricsToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	s.metrics.handler.ServeHTTP(w, r)
+}
+
+// serverCollector reads the database pool, cache and session counts when
+// Prometheus scrapes, rather than keeping copies of them up to date.
+type serverCollector struct {
+	s *Server
+
+	cacheRequests        *prometheus.Desc
+	poolMaxConns         *prometheus.Desc
+	poolTotalConns       *prometheus.Desc
+	poolIdleConns        *prometheus.Desc
+	poolAcquiredConns    *prometheus.Desc
+	poolAcquires         *prometheus.Desc
+	poolAcquireSeconds   *prometheus.Desc
+	poolEmptyAcquires    *prometheus.Desc
+	poolCanceledAcquires *prometheus.Desc
+	sessions             *prometheus.Desc
+}
+
+func newServerCollector(s *Server) *serverCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", name), help, labels, nil)
+	}
+	return &serverCollector{
+		s:                    s,
+		cacheRequests:        desc("cache_requests_total", "Content cache lookups by entity and result (hit or miss).", "entity", "result"),
+		poolMaxConns:         desc("db_pool_max_conns", "Maximum size of the database connection pool."),
+		poolTotalConns:       desc("db_pool_total_conns", "Connections currently open, idle or in use."),
+		poolIdleConns:        desc("db_pool_idle_conns", "Idle connections in the pool."),
+		poolAcquiredConns:    desc("db_pool_acquired_conns", "Connections currently in use."),
+		poolAcquires:         desc("db_pool_acquires_total", "Successful connection acquires from the pool."),
+		poolAcquireSeconds:   desc("db_pool_acquire_seconds_total", "Total time spent acquiring connections from the pool."),
+		poolEmptyAcquires:    desc("db_pool_empty_acquires_total", "Acquires that had to wait because no connection was idle."),
+		poolCanceledAcquires: desc("db_pool_canceled_acquires_total", "Acquires abandoned because their context was canceled."),
+		sessions:             desc("sessions_active", "Signed-in admin sessions that haven't expired."),
+	}
+}
+
+func (c *serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cacheRequests
+	ch <- c.poolMaxConns
+	ch <- c.poolTotalConns
+	ch <- c.poolIdleConns
+	ch <- c.poolAcquiredConns
+	ch <- c.poolAcquires
+	ch <- c.poolAcquireSeconds
+	ch <- c.poolEmptyAcquires
+	ch <- c.poolCanceledAcquires
+	ch <- c.sessions
+}
+
+func (c *serverCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.s.db.Stats()
+	for _, e := range stats.Cache {
+		ch <- prometheus.MustNewConstMetric(c.cacheRequests, prometheus.CounterValue, float64(e.Hits), e.Entity, "hit")
+		ch <- prometheus.MustNewConstMetric(c.cacheRequests, prometheus.CounterValue, float64(e.Misses), e.Entity, "miss")
+	}
+
+	if pool := stats.Pool; pool != nil {
+		ch <- prometheus.MustNewConstMetric(c.poolMaxConns, prometheus.GaugeValue, float64(pool.MaxConns))
+		ch <- prometheus.MustNewConstMetric(c.poolTotalConns, prometheus.GaugeValue, float64(pool.TotalConns))
+		ch <- prometheus.MustNewConstMetric(c.poolIdleConns, prometheus.GaugeValue, float64(pool.IdleConns))
+		ch <- prometheus.MustNewConstMetric(c.poolAcquiredConns, prometheus.GaugeValue, float64(pool.AcquiredConns))
+		ch <- prometheus.MustNewConstMetric(c.poolAcquires, prometheus.CounterValue, float64(pool.AcquireCount))
+		ch <- prometheus.MustNewConstMetric(c.poolAcquireSeconds, prometheus.CounterValue, pool.AcquireDuration.Seconds())
+		ch <- prometheus.MustNewConstMetric(c.poolEmptyAcquires, prometheus.CounterValue, float64(pool.EmptyAcquireCount))
+		ch <- prometheus.MustNewConstMetric(c.poolCanceledAcquires, prometheus.CounterValue, float64(pool.CanceledAcquireCount))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionCountTimeout)
+	defer cancel()
+	sessions, err := c.s.sessions.List(ctx)
+	if err != nil {
+		slog.Error("Failed to count sessions for metrics", "error", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(len(sessions)))
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/health"
+)
+
+// newReadinessChecks returns the checks every server runs against its
+// database. Callers add the ones for parts they own, such as templates and
+// workers, with AddReadinessCheck.
+func newReadinessChecks(db database.Database) *health.Registry {
+	checks := health.NewRegistry()
+	checks.Add("database", db.Ping)
+	checks.Add("migrations", func(ctx context.Context) error {
+		applied, latest, err := db.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		// A newer schema is fine: during a rolling deploy the new
+		// replicas migrate while the old ones are still serving
+		if applied < latest {
+			return fmt.Errorf("schema is at version %d, expected %d", applied, latest)
+		}
+		return nil
+	})
+	return checks
+}
+
+// AddReadinessCheck adds a named check to /ready. It must be called before
+// the server starts.
+func (s *Server) AddReadinessCheck(name string, check health.Check) {
+	s.checks.Add(name, check)
+}
+
+// HandleReady tells load balancers whether to send traffic here. Unlike
+// /health, which only shows the process is alive, it runs every readiness
+// check and fails from the moment shutdown begins.
+func (s *Server) HandleReady(w http.ResponseWriter, r *http.Request) {
+	report := health.Report{Status: health.StatusDraining, Checks: []health.Result{}}
+	status := http.StatusServiceUnavailable
+	if s.ready.Load() {
+		report = s.checks.Run(r.Context())
+		if report.OK() {
+			status = http.StatusOK
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("Failed to write readiness report", "error", err)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// SetTrustedProxies sets the reverse proxies whose X-Forwarded-For and
+// X-Real-IP headers are believed, as a comma-separated list of addresses
+// and CIDR ranges. With none set, the headers are ignored and every request
+// is attributed to the address that connected.
+func (s *Server) SetTrustedProxies(list string) error {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	s.trustedProxies = proxies
+	return nil
+}
+
+// realIP replaces r.RemoteAddr with the client address reported by a
+// trusted proxy. Headers from anyone else are ignored, since a client could
+// otherwise pick a new address for every request and slip past the
+// per-address limits.
+func (s *Server) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if peer, ok := parseIP(r.RemoteAddr); ok && s.trustedProxy(peer) {
+			if client, ok := s.forwardedFor(r); ok {
+				r.RemoteAddr = client.String()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the client address the proxies recorded. Each proxy
+// appends the address it was connected from to X-Forwarded-For, so the
+// list is read from the right and the first untrusted entry is the client;
+// anything to its left was sent by the client itself.
+func (s *Server) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	if len(hops) == 1 && strings.TrimSpace(hops[0]) == "" {
+		return parseIP(r.Header.Get("X-Real-IP"))
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseIP(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !s.trustedProxy(addr) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+	for _, p := range s.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP reads an address with or without a port.
+func parseIP(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
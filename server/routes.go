@@ -7,39 +7,83 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
+
+	"github.com/alexraskin/standwithiran/internal/models"
 )
 
 func (s *Server) Routes() http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(middleware.RealIP)
+	r.Use(s.realIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(middleware.Compress(5))
 	r.Use(httprate.Limit(500, time.Minute))
 	r.Use(middleware.Heartbeat("/health"))
+	r.Use(s.instrument)
 	r.Use(s.cacheControl)
+	r.Use(s.securityHeaders)
 
 	r.Mount("/static", http.FileServer(s.assets))
 
+	r.Get("/ready", s.HandleReady)
+	r.Get("/metrics", s.HandleMetrics)
 	r.Handle("/robots.txt", s.serveFile("static/robots.txt"))
 	r.Handle("/favicon.ico", s.serveFile("static/images/favicon.ico"))
 
+	r.With(httprate.LimitByIP(60, time.Minute)).Post(cspReportPath, s.HandleCSPReport)
+
 	r.Get("/", s.HandleIndex)
+	r.Get("/go/{id}", s.HandleLinkRedirect)
 	r.Get("/admin/login", s.HandleLoginPage)
 	r.Post("/admin/login", s.HandleLogin)
-	r.Get("/admin/logout", s.HandleLogout)
+	r.Get("/admin/login/2fa", s.HandleSecondFactorPage)
+	r.Post("/admin/login/2fa", s.HandleSecondFactor)
 
 	r.Group(func(r chi.Router) {
 		r.Use(s.RequireAuth)
+		r.Use(s.VerifyCSRF)
 		r.Get("/admin", s.HandleAdmin)
-		r.Post("/admin/links/add", s.HandleAddLink)
-		r.Post("/admin/links/delete", s.HandleDeleteLink)
-		r.Post("/admin/links/featured", s.HandleToggleFeatured)
-		r.Post("/admin/profile", s.HandleUpdateProfile)
 		r.Post("/admin/password", s.HandleUpdatePassword)
-		r.Post("/admin/banner", s.HandleUpdateBanner)
+		r.Get("/admin/2fa", s.HandleTwoFactor)
+		r.Post("/admin/2fa/enable", s.HandleEnableTwoFactor)
+		r.Post("/admin/2fa/disable", s.HandleDisableTwoFactor)
+		r.Get("/admin/banners", s.HandleBanners)
+		r.Get("/admin/export", s.HandleExport)
+		r.Get("/admin/analytics", s.HandleAnalytics)
+		r.Get("/admin/sessions", s.HandleSessions)
+		r.Post("/admin/sessions/revoke", s.HandleRevokeSession)
+		r.Post("/admin/sessions/revoke-all", s.HandleRevokeAllSessions)
+		r.Post("/admin/logout", s.HandleLogout)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequireRole(models.RoleEditor))
+			r.Post("/admin/links/add", s.HandleAddLink)
+			r.Post("/admin/links/import", s.HandleImportLinksCSV)
+			r.Get("/admin/links/edit", s.HandleEditLinkPage)
+			r.Post("/admin/links/edit", s.HandleEditLink)
+			r.Post("/admin/links/delete", s.HandleDeleteLink)
+			r.Post("/admin/links/featured", s.HandleToggleFeatured)
+			r.Post("/admin/links/move", s.HandleMoveLink)
+			r.Post("/admin/links/reorder", s.HandleReorderLinks)
+			r.Post("/admin/profile", s.HandleUpdateProfile)
+			r.Post("/admin/banner", s.HandleUpdateBanner)
+			r.Post("/admin/banners/add", s.HandleAddBanner)
+			r.Post("/admin/banners/delete", s.HandleDeleteBanner)
+			r.Post("/admin/import", s.HandleImport)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequireRole(models.RoleOwner))
+			r.Get("/admin/users", s.HandleUsers)
+			r.Post("/admin/users/add", s.HandleAddUser)
+			r.Post("/admin/users/role", s.HandleSetUserRole)
+			r.Post("/admin/users/password", s.HandleResetUserPassword)
+			r.Post("/admin/users/2fa", s.HandleResetUserTwoFactor)
+			r.Post("/admin/users/delete", s.HandleDeleteUser)
+			r.Get("/admin/login-failures", s.HandleLoginFailures)
+		})
 	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
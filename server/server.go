@@ -1,41 +1,91 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"runtime"
-	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alexraskin/standwithiran/internal/analytics"
 	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/health"
+	"github.com/alexraskin/standwithiran/internal/loginlimit"
+	"github.com/alexraskin/standwithiran/internal/session"
 )
 
+// MinPasswordLength is the shortest admin password accepted by the admin
+// panel and the set-password command.
+const MinPasswordLength = 6
+
+// passwordTooShort is the query-escaped error shown for a password shorter
+// than MinPasswordLength.
+var passwordTooShort = url.QueryEscape(fmt.Sprintf("Password must be at least %d characters", MinPasswordLength))
+
 type ExecuteTemplateFunc func(wr io.Writer, name string, data any) error
 
 type Server struct {
-	version    string
-	port       string
-	server     *http.Server
-	assets     http.FileSystem
-	tmplFunc   ExecuteTemplateFunc
-	sessions   map[string]time.Time
-	sessionsMu sync.RWMutex
-	db         database.Database
+	version   string
+	port      string
+	server    *http.Server
+	assets    http.FileSystem
+	tmplFunc  ExecuteTemplateFunc
+	sessions  session.Store
+	db        database.Database
+	analytics *analytics.Recorder
+	// logins limits sign-in attempts per client address and accounts per
+	// account. Accounts are only slowed down, never locked out, so nobody
+	// can lock an owner out without knowing the password.
+	logins   *loginlimit.Limiter
+	accounts *loginlimit.Limiter
+	// retentionDays is only shown on the analytics page; pruning is done by
+	// the worker that owns the retention setting.
+	retentionDays int
+	// brokenAfter is the number of consecutive failed link checks after
+	// which a link is flagged, and hidden from the public page if
+	// hideBroken is set.
+	brokenAfter int
+	hideBroken  bool
+	// hstsMaxAge and cspReportOnly configure securityHeaders.
+	hstsMaxAge    time.Duration
+	cspReportOnly bool
+	// ready is reported by /ready: set once the server is listening and
+	// cleared as soon as shutdown begins.
+	ready atomic.Bool
+	// checks must all pass for /ready to report the server ready.
+	checks *health.Registry
+	// metrics backs /metrics; metricsToken, if set, must be sent as a
+	// bearer token to read it.
+	metrics      *metrics
+	metricsToken string
+	// referrerKey signs the referring domain on the index page's links.
+	referrerKey []byte
+	// trustedProxies may set the client address with forwarded headers.
+	trustedProxies []netip.Prefix
 }
 
 func NewServer(version string, port string, assets http.FileSystem, tmplFunc ExecuteTemplateFunc, db database.Database) *Server {
 
 	s := &Server{
-		version:    version,
-		port:       port,
-		assets:     assets,
-		tmplFunc:   tmplFunc,
-		sessions:   make(map[string]time.Time),
-		sessionsMu: sync.RWMutex{},
-		db:         db,
+		version:     version,
+		port:        port,
+		assets:      assets,
+		tmplFunc:    tmplFunc,
+		sessions:    session.NewMemoryStore(),
+		db:          db,
+		analytics:   analytics.NewRecorder(),
+		logins:      loginlimit.New(),
+		accounts:    loginlimit.NewBackoffOnly(),
+		checks:      newReadinessChecks(db),
+		referrerKey: newReferrerKey(),
 	}
+	s.metrics = newMetrics(s)
 
 	s.server = &http.Server{
 		Addr:    ":" + port,
@@ -45,16 +95,60 @@ func NewServer(version string, port string, assets http.FileSystem, tmplFunc Exe
 	return s
 }
 
-func (s *Server) Start() {
-	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		panic(err)
+// Analytics returns the recorder buffering page views and clicks so the
+// caller can flush it periodically and on shutdown.
+func (s *Server) Analytics() *analytics.Recorder {
+	return s.analytics
+}
+
+// SetSessionStore replaces the default in-memory session store, which
+// forgets sessions on restart and isn't shared between replicas. It must be
+// called before the server starts.
+func (s *Server) SetSessionStore(store session.Store) {
+	s.sessions = store
+}
+
+// SetAnalyticsRetention sets the retention shown on the analytics page.
+func (s *Server) SetAnalyticsRetention(days int) {
+	s.retentionDays = days
+}
+
+// SetLinkCheckPolicy sets how many consecutive failed checks flag a link as
+// broken and whether broken links are hidden from the public page.
+func (s *Server) SetLinkCheckPolicy(failures int, hide bool) {
+	s.brokenAfter = failures
+	s.hideBroken = hide
+}
+
+// Start listens on the configured port and serves until Shutdown, which
+// makes it return nil. The server reports ready once it is listening.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
 	}
+	s.ready.Store(true)
+	if err := s.server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Drain makes /ready fail so load balancers stop sending new traffic, while
+// requests keep being served until Shutdown.
+func (s *Server) Drain() {
+	s.ready.Store(false)
 }
 
-func (s *Server) Close() {
-	if err := s.server.Close(); err != nil {
-		panic(err)
+// Shutdown stops accepting connections and waits for in-flight requests to
+// finish. Connections still open when ctx is done are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Drain()
+	if err := s.server.Shutdown(ctx); err != nil {
+		_ = s.server.Close()
+		return fmt.Errorf("failed to drain connections: %w", err)
 	}
+	return nil
 }
 
 func FormatBuildVersion(version string) string {
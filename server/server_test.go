@@ -1,23 +1,44 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
 	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/alexraskin/standwithiran/internal/analytics"
+	"github.com/alexraskin/standwithiran/internal/cache"
 	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/database/memory"
+	"github.com/alexraskin/standwithiran/internal/health"
+	"github.com/alexraskin/standwithiran/internal/loginlimit"
 	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/session"
+	"github.com/alexraskin/standwithiran/internal/totp"
 )
 
 type MockDatabase struct {
-	profile       models.Profile
-	links         []models.Link
-	banner        models.Banner
+	profile models.Profile
+	links   []models.Link
+	banner  models.Banner
+	// users defaults to a single "admin" owner; every account shares
+	// password.
+	users         []models.User
 	password      string
 	profileErr    error
 	linksErr      error
@@ -26,10 +47,37 @@ type MockDatabase struct {
 	addLinkErr    error
 	deleteLinkErr error
 	updateErr     error
+	reorderCalls  int
+	clicks        map[string]int
+	analytics     []models.AnalyticsCount
+	health        map[string]models.LinkHealth
+	banners       []models.ScheduledBanner
+	failures      []models.LoginFailure
+	pingErr       error
+	// schemaVersion and latestSchemaVersion are what SchemaVersion reports.
+	schemaVersion       int
+	latestSchemaVersion int
+	stats               database.Stats
 }
 
 func (m *MockDatabase) Close() {}
 
+func (m *MockDatabase) Ping(ctx context.Context) error {
+	return m.pingErr
+}
+
+func (m *MockDatabase) Stats() database.Stats {
+	return m.stats
+}
+
+func (m *MockDatabase) SchemaVersion(ctx context.Context) (int, int, error) {
+	return m.schemaVersion, m.latestSchemaVersion, nil
+}
+
+func (m *MockDatabase) Migrate(ctx context.Context) error {
+	return nil
+}
+
 func (m *MockDatabase) GetProfile(ctx context.Context) (models.Profile, error) {
 	return m.profile, m.profileErr
 }
@@ -48,6 +96,27 @@ func (m *MockDatabase) AddLink(ctx context.Context, l models.Link) error {
 	return m.addLinkErr
 }
 
+func (m *MockDatabase) AddLinks(ctx context.Context, links []models.Link) error {
+	if m.addLinkErr != nil {
+		return m.addLinkErr
+	}
+	m.links = append(m.links, links...)
+	return nil
+}
+
+func (m *MockDatabase) UpdateLink(ctx context.Context, l models.Link) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	for i := range m.links {
+		if m.links[i].ID == l.ID {
+			m.links[i] = l
+			return nil
+		}
+	}
+	return database.ErrLinkNotFound
+}
+
 func (m *MockDatabase) DeleteLink(ctx context.Context, id string) error {
 	return m.deleteLinkErr
 }
@@ -56,18 +125,145 @@ func (m *MockDatabase) UpdateLinkFeatured(ctx context.Context, id string, featur
 	return m.updateErr
 }
 
-func (m *MockDatabase) VerifyPassword(ctx context.Context, password string) (bool, error) {
+func (m *MockDatabase) ReorderLinks(ctx context.Context, ids []string) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	m.reorderCalls++
+	byID := make(map[string]models.Link, len(m.links))
+	for _, l := range m.links {
+		byID[l.ID] = l
+	}
+	links := make([]models.Link, 0, len(ids))
+	for _, id := range ids {
+		l, ok := byID[id]
+		if !ok {
+			return database.ErrLinkNotFound
+		}
+		links = append(links, l)
+	}
+	m.links = links
+	return nil
+}
+
+func (m *MockDatabase) userList() []models.User {
+	if m.users == nil {
+		m.users = []models.User{{Username: "admin", Role: models.RoleOwner}}
+	}
+	return m.users
+}
+
+func (m *MockDatabase) AuthenticateUser(ctx context.Context, username, password string) (models.User, error) {
 	if m.verifyErr != nil {
-		return false, m.verifyErr
+		return models.User{}, m.verifyErr
+	}
+	u, err := m.GetUser(ctx, username)
+	if err != nil || password != m.password {
+		return models.User{}, database.ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+func (m *MockDatabase) GetUser(ctx context.Context, username string) (models.User, error) {
+	for _, u := range m.userList() {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return models.User{}, database.ErrUserNotFound
+}
+
+func (m *MockDatabase) GetUsers(ctx context.Context) ([]models.User, error) {
+	return m.userList(), nil
+}
+
+func (m *MockDatabase) AddUser(ctx context.Context, u models.User, password string) error {
+	if _, err := m.GetUser(ctx, u.Username); err == nil {
+		return database.ErrUserExists
 	}
-	return password == m.password, nil
+	m.users = append(m.userList(), u)
+	return m.updateErr
 }
 
-func (m *MockDatabase) SetPassword(ctx context.Context, password string) error {
+func (m *MockDatabase) SetUserPassword(ctx context.Context, username, password string) error {
+	if _, err := m.GetUser(ctx, username); err != nil {
+		return err
+	}
 	m.password = password
 	return m.updateErr
 }
 
+func (m *MockDatabase) SetUserRole(ctx context.Context, username, role string) error {
+	for i, u := range m.userList() {
+		if u.Username == username {
+			m.users[i].Role = role
+			return m.updateErr
+		}
+	}
+	return database.ErrUserNotFound
+}
+
+func (m *MockDatabase) DeleteUser(ctx context.Context, username string) error {
+	if _, err := m.GetUser(ctx, username); err != nil {
+		return err
+	}
+	m.users = slices.DeleteFunc(m.users, func(u models.User) bool { return u.Username == username })
+	return m.updateErr
+}
+
+func (m *MockDatabase) GetTOTPSecret(ctx context.Context, username string) (string, error) {
+	return "", nil
+}
+
+func (m *MockDatabase) EnableTOTP(ctx context.Context, username, secret string, step int64, recoveryHashes []string) error {
+	return m.updateErr
+}
+
+func (m *MockDatabase) DisableTOTP(ctx context.Context, username string) error {
+	_, err := m.GetUser(ctx, username)
+	return err
+}
+
+func (m *MockDatabase) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockDatabase) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockDatabase) CountRecoveryCodes(ctx context.Context, username string) (int, error) {
+	return 0, nil
+}
+
+func (m *MockDatabase) CreateSession(ctx context.Context, hash string, sess models.Session) error {
+	return nil
+}
+
+func (m *MockDatabase) GetSession(ctx context.Context, hash string) (models.Session, error) {
+	return models.Session{}, database.ErrSessionNotFound
+}
+
+func (m *MockDatabase) ListSessions(ctx context.Context, now time.Time) ([]models.Session, error) {
+	return nil, nil
+}
+
+func (m *MockDatabase) UpdateSession(ctx context.Context, hash string, sess models.Session) error {
+	return database.ErrSessionNotFound
+}
+
+func (m *MockDatabase) DeleteSession(ctx context.Context, hash string) error {
+	return nil
+}
+
+func (m *MockDatabase) DeleteUserSessions(ctx context.Context, username, keep string) (int, error) {
+	return 0, nil
+}
+
+func (m *MockDatabase) DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
 func (m *MockDatabase) GetBanner(ctx context.Context) (models.Banner, error) {
 	return m.banner, m.bannerErr
 }
@@ -77,19 +273,145 @@ func (m *MockDatabase) UpdateBanner(ctx context.Context, b models.Banner) error
 	return m.updateErr
 }
 
+func (m *MockDatabase) ReplaceContent(ctx context.Context, c models.Content) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	m.profile = c.Profile
+	m.links = c.Links
+	m.banner = c.Banner
+	return nil
+}
+
+func (m *MockDatabase) RecordClick(ctx context.Context, linkID string) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	if m.clicks == nil {
+		m.clicks = make(map[string]int)
+	}
+	m.clicks[linkID]++
+	return nil
+}
+
+func (m *MockDatabase) GetClickCounts(ctx context.Context) (map[string]int, error) {
+	return m.clicks, nil
+}
+
+func (m *MockDatabase) IncrementAnalytics(ctx context.Context, counts []models.AnalyticsCount) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	m.analytics = append(m.analytics, counts...)
+	return nil
+}
+
+func (m *MockDatabase) GetAnalytics(ctx context.Context, since string) ([]models.AnalyticsRow, error) {
+	var rows []models.AnalyticsRow
+	for _, c := range m.analytics {
+		if c.Day < since {
+			continue
+		}
+		row := models.AnalyticsRow{Day: c.Day, Referrer: c.Referrer}
+		if c.Kind == models.AnalyticsView {
+			row.Views = c.Count
+		} else {
+			row.Clicks = c.Count
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (m *MockDatabase) PruneAnalytics(ctx context.Context, before string) error {
+	return m.updateErr
+}
+
+func (m *MockDatabase) GetLinkHealth(ctx context.Context) (map[string]models.LinkHealth, error) {
+	return m.health, nil
+}
+
+func (m *MockDatabase) UpdateLinkHealth(ctx context.Context, h models.LinkHealth) error {
+	if m.health == nil {
+		m.health = make(map[string]models.LinkHealth)
+	}
+	m.health[h.LinkID] = h
+	return nil
+}
+
+func (m *MockDatabase) GetScheduledBanners(ctx context.Context) ([]models.ScheduledBanner, error) {
+	if m.bannerErr != nil {
+		return nil, m.bannerErr
+	}
+	return m.banners, nil
+}
+
+func (m *MockDatabase) AddScheduledBanner(ctx context.Context, b models.ScheduledBanner) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	m.banners = append(m.banners, b)
+	return nil
+}
+
+func (m *MockDatabase) DeleteScheduledBanner(ctx context.Context, id string) error {
+	m.banners = slices.DeleteFunc(m.banners, func(b models.ScheduledBanner) bool { return b.ID == id })
+	return nil
+}
+
+func (m *MockDatabase) RecordLoginFailure(ctx context.Context, f models.LoginFailure) error {
+	m.failures = append(m.failures, f)
+	return nil
+}
+
+func (m *MockDatabase) GetLoginFailures(ctx context.Context, limit int) ([]models.LoginFailure, error) {
+	return m.failures, nil
+}
+
+func (m *MockDatabase) PruneLoginFailures(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
 func mockTemplateFunc(wr io.Writer, name string, data any) error {
 	_, err := wr.Write([]byte("rendered: " + name))
 	return err
 }
 
 func newTestServer(db database.Database) *Server {
-	return &Server{
-		version:  "test",
-		port:     "8080",
-		tmplFunc: mockTemplateFunc,
-		sessions: make(map[string]time.Time),
-		db:       db,
+	s := &Server{
+		version:     "test",
+		port:        "8080",
+		tmplFunc:    mockTemplateFunc,
+		sessions:    session.NewMemoryStore(),
+		db:          db,
+		analytics:   analytics.NewRecorder(),
+		logins:      loginlimit.New(),
+		accounts:    loginlimit.NewBackoffOnly(),
+		checks:      newReadinessChecks(db),
+		referrerKey: newReferrerKey(),
 	}
+	s.metrics = newMetrics(s)
+	return s
+}
+
+// newSession signs username in and returns the session token.
+func newSession(t *testing.T, s *Server, username string) string {
+	t.Helper()
+	token, err := s.createSession(httptest.NewRequest("POST", "/admin/login", nil), username)
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	return token
+}
+
+// csrfToken returns the CSRF token forms posted with a session must carry.
+func csrfToken(t *testing.T, s *Server, token string) string {
+	t.Helper()
+	sess, err := s.sessions.Get(context.Background(), token)
+	if err != nil {
+		t.Fatalf("loading session: %v", err)
+	}
+	return sess.CSRFToken
 }
 
 func TestFormatBuildVersion(t *testing.T) {
@@ -105,19 +427,16 @@ func TestFormatBuildVersion(t *testing.T) {
 func TestSessionCreateAndValidate(t *testing.T) {
 	s := newTestServer(&MockDatabase{})
 
-	token := s.createSession()
-	if token == "" {
-		t.Fatal("createSession returned empty token")
-	}
+	token := newSession(t, s, "admin")
 	if len(token) != 64 { // 32 bytes hex encoded = 64 chars
 		t.Errorf("expected token length 64, got %d", len(token))
 	}
 
-	if !s.validateSession(token) {
+	if !s.validateSession(context.Background(), token) {
 		t.Error("expected session to be valid")
 	}
 
-	if s.validateSession("invalid-token") {
+	if s.validateSession(context.Background(), "invalid-token") {
 		t.Error("expected invalid token to fail validation")
 	}
 }
@@ -125,14 +444,14 @@ func TestSessionCreateAndValidate(t *testing.T) {
 func TestSessionDelete(t *testing.T) {
 	s := newTestServer(&MockDatabase{})
 
-	token := s.createSession()
-	if !s.validateSession(token) {
+	token := newSession(t, s, "admin")
+	if !s.validateSession(context.Background(), token) {
 		t.Fatal("session should be valid before deletion")
 	}
 
-	s.deleteSession(token)
+	s.deleteSession(context.Background(), token)
 
-	if s.validateSession(token) {
+	if s.validateSession(context.Background(), token) {
 		t.Error("session should be invalid after deletion")
 	}
 }
@@ -140,14 +459,12 @@ func TestSessionDelete(t *testing.T) {
 func TestSessionExpiry(t *testing.T) {
 	s := newTestServer(&MockDatabase{})
 
-	token := s.createSession()
+	token := newSession(t, s, "admin")
 
 	// Manually expire the session
-	s.sessionsMu.Lock()
-	s.sessions[token] = time.Now().Add(-1 * time.Hour)
-	s.sessionsMu.Unlock()
+	s.sessions.Update(context.Background(), token, models.Session{Username: "admin", ExpiresAt: time.Now().Add(-1 * time.Hour)})
 
-	if s.validateSession(token) {
+	if s.validateSession(context.Background(), token) {
 		t.Error("expired session should be invalid")
 	}
 }
@@ -212,7 +529,7 @@ func TestHandleLoginPage(t *testing.T) {
 
 func TestHandleLoginPageRedirectIfLoggedIn(t *testing.T) {
 	s := newTestServer(&MockDatabase{})
-	token := s.createSession()
+	token := newSession(t, s, "admin")
 
 	req := httptest.NewRequest("GET", "/admin/login", nil)
 	req.AddCookie(&http.Cookie{Name: "session", Value: token})
@@ -230,6 +547,7 @@ func TestHandleLoginSuccess(t *testing.T) {
 	s := newTestServer(db)
 
 	form := url.Values{}
+	form.Set("username", "admin")
 	form.Set("password", "correct-password")
 	req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -260,6 +578,7 @@ func TestHandleLoginFailure(t *testing.T) {
 	s := newTestServer(db)
 
 	form := url.Values{}
+	form.Set("username", "admin")
 	form.Set("password", "wrong-password")
 	req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -275,9 +594,171 @@ func TestHandleLoginFailure(t *testing.T) {
 	}
 }
 
+func TestLoginThrottling(t *testing.T) {
+	db := &MockDatabase{password: "correct-password"}
+	s := newTestServer(db)
+
+	var rendered map[string]string
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered, _ = data.(map[string]string)
+		return nil
+	}
+	login := func(addr, password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"admin"}, "password": {password}}
+		req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		s.HandleLogin(w, req)
+		return w
+	}
+
+	for range loginlimit.FreeAttempts {
+		if w := login("203.0.113.7:1234", "wrong-password"); w.Code != http.StatusOK {
+			t.Fatalf("expected a plain failure, got %d", w.Code)
+		}
+	}
+	if len(db.failures) != loginlimit.FreeAttempts {
+		t.Fatalf("expected %d recorded failures, got %d", loginlimit.FreeAttempts, len(db.failures))
+	}
+	if f := db.failures[0]; f.Username != "admin" || f.Address != "203.0.113.7" || f.Reason != models.LoginFailurePassword {
+		t.Errorf("unexpected failure record %+v", f)
+	}
+
+	w := login("203.0.113.7:1234", "correct-password")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected the address to be throttled, got %d retry %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rendered["Throttled"], "1 second") || rendered["Locked"] != "" {
+		t.Errorf("expected a backoff message, got %+v", rendered)
+	}
+	if len(db.failures) != loginlimit.FreeAttempts {
+		t.Error("expected throttled attempts not to be checked or recorded")
+	}
+
+	for range loginlimit.LockoutAfter - loginlimit.FreeAttempts {
+		s.logins.Fail("ip:203.0.113.7")
+	}
+	w = login("203.0.113.7:1234", "correct-password")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "900" {
+		t.Errorf("expected the address to be locked out, got %d retry %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rendered["Locked"], "15 minutes") || rendered["Throttled"] != "" {
+		t.Errorf("expected a lockout message, got %+v", rendered)
+	}
+
+	// Someone else's failures slow the account down but can't lock it out
+	w = login("198.51.100.1:1234", "correct-password")
+	if rendered["Locked"] != "" {
+		t.Errorf("expected the account not to be locked out from another address, got %+v", rendered)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry > int(loginlimit.BackoffOnlyMaxDelay/time.Second) {
+		t.Errorf("expected at most a short wait from another address, got %d", retry)
+	}
+}
+
+func TestLoginThrottlingAcrossAddresses(t *testing.T) {
+	db := &MockDatabase{password: "correct-password"}
+	s := newTestServer(db)
+
+	// Every guess for the same account comes from a different address
+	var w *httptest.ResponseRecorder
+	for i := range loginlimit.FreeAttempts + 1 {
+		form := url.Values{"username": {"admin"}, "password": {"guess"}}
+		req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", i+1)
+		w = httptest.NewRecorder()
+		s.HandleLogin(w, req)
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the account to be throttled across addresses, got %d", w.Code)
+	}
+	if len(db.failures) != loginlimit.FreeAttempts {
+		t.Errorf("expected the throttled guess not to be checked, got %d failures", len(db.failures))
+	}
+}
+
+func TestLoginThrottlingIgnoresForwardedFor(t *testing.T) {
+	s := newTestServer(&MockDatabase{password: "correct-password"})
+	handler := s.Routes()
+
+	// One machine tries a different account each time and claims a new
+	// address in every request
+	var w *httptest.ResponseRecorder
+	for i := range loginlimit.FreeAttempts + 1 {
+		form := url.Values{"username": {fmt.Sprintf("user%d", i)}, "password": {"guess"}}
+		req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+		req.Header.Set("X-Real-IP", fmt.Sprintf("192.0.2.%d", i+1))
+		req.RemoteAddr = "203.0.113.7:1234"
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the address to be throttled despite forwarded headers, got %d", w.Code)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+	if err := s.SetTrustedProxies("10.0.0.0/8, 127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"203.0.113.7:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7:1234"},
+		{"203.0.113.7:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7:1234"},
+		{"127.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"127.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "10.9.9.9"}, "10.9.9.9"},
+		{"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.1.2.3:1234"},
+		{"10.1.2.3:1234", nil, "10.1.2.3:1234"},
+	}
+	for _, tt := range tests {
+		var got string
+		handler := s.realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.RemoteAddr
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("%s %v: got %q, want %q", tt.remote, tt.headers, got, tt.want)
+		}
+	}
+
+	if err := s.SetTrustedProxies("10.0.0.0/8,proxy"); err == nil {
+		t.Error("expected an invalid proxy to be rejected")
+	}
+}
+
+func TestFormatWait(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Second:             "1 second",
+		1500 * time.Millisecond: "2 seconds",
+		time.Minute:             "60 seconds",
+		14*time.Minute + 1:      "15 minutes",
+	}
+	for wait, want := range tests {
+		if got := formatWait(wait); got != want {
+			t.Errorf("formatWait(%v) = %q, want %q", wait, got, want)
+		}
+	}
+}
+
 func TestHandleLogout(t *testing.T) {
 	s := newTestServer(&MockDatabase{})
-	token := s.createSession()
+	token := newSession(t, s, "admin")
 
 	req := httptest.NewRequest("POST", "/admin/logout", nil)
 	req.AddCookie(&http.Cookie{Name: "session", Value: token})
@@ -290,11 +771,40 @@ func TestHandleLogout(t *testing.T) {
 	}
 
 	// Session should be deleted
-	if s.validateSession(token) {
+	if s.validateSession(context.Background(), token) {
 		t.Error("session should be invalid after logout")
 	}
 }
 
+func TestLogoutRequiresCSRF(t *testing.T) {
+	s := newTestServer(memory.New())
+	handler := s.Routes()
+	token := newSession(t, s, memory.DefaultUsername)
+	ctx := context.Background()
+
+	logout := func(method string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	logout("GET", nil)
+	if w := logout("POST", nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected a logout without a CSRF token to be rejected, got %d", w.Code)
+	}
+	if !s.validateSession(ctx, token) {
+		t.Fatal("expected the session to survive a forged logout")
+	}
+
+	w := logout("POST", url.Values{csrfField: {csrfToken(t, s, token)}})
+	if w.Code != http.StatusSeeOther || s.validateSession(ctx, token) {
+		t.Errorf("expected logout to end the session, got %d", w.Code)
+	}
+}
+
 func TestHandleAddLinkMissingFields(t *testing.T) {
 	s := newTestServer(&MockDatabase{})
 
@@ -324,7 +834,7 @@ func TestHandleAddLinkSuccess(t *testing.T) {
 	form.Set("title", "Test Link")
 	form.Set("url", "https://example.com")
 	form.Set("category", "fundraiser")
-	form.Set("icon", "💰")
+	form.Set("icon", "money")
 	req := httptest.NewRequest("POST", "/admin/links/add", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
@@ -343,74 +853,410 @@ func TestHandleAddLinkSuccess(t *testing.T) {
 	}
 }
 
-func TestHandleUpdatePasswordTooShort(t *testing.T) {
-	s := newTestServer(&MockDatabase{})
+func TestHandleAddLinkCategoryAndIcon(t *testing.T) {
+	tests := []struct {
+		name     string
+		form     url.Values
+		category string
+		icon     string
+	}{
+		{"unknown category", url.Values{"category": {"<script>"}, "icon": {"heart"}}, "", ""},
+		{"unknown icon", url.Values{"category": {"news"}, "icon": {"💰"}}, "", ""},
+		{"defaults", url.Values{}, models.DefaultCategory, models.DefaultIcon},
+		{"known", url.Values{"category": {"news"}, "icon": {"megaphone"}}, "news", "megaphone"},
+	}
 
-	form := url.Values{}
-	form.Set("new_password", "12345") // Less than 6 chars
-	req := httptest.NewRequest("POST", "/admin/password", strings.NewReader(form.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	w := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &MockDatabase{}
+			s := newTestServer(db)
+
+			tt.form.Set("title", "Link")
+			tt.form.Set("url", "https://relief.example")
+			req := httptest.NewRequest("POST", "/admin/links/add", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			s.HandleAddLink(w, req)
+
+			if tt.category == "" {
+				if len(db.links) != 0 || !strings.Contains(w.Header().Get("Location"), "error=") {
+					t.Errorf("expected the link to be rejected, got links %+v (redirect %q)", db.links, w.Header().Get("Location"))
+				}
+				return
+			}
+			if len(db.links) != 1 || db.links[0].Category != tt.category || db.links[0].Icon != tt.icon {
+				t.Errorf("expected %s/%s to be saved, got %+v", tt.category, tt.icon, db.links)
+			}
+		})
+	}
+}
 
-	s.HandleUpdatePassword(w, req)
+func TestHandleAddLinkURLPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		form  url.Values
+		saved string
+	}{
+		{"script", url.Values{"url": {"javascript:alert(document.cookie)"}}, ""},
+		{"tab in scheme", url.Values{"url": {"java\tscript:alert(1)"}}, ""},
+		{"data", url.Values{"url": {"data:text/html;base64,PHNjcmlwdD4="}}, ""},
+		{"loopback", url.Values{"url": {"http://127.0.0.1:8080/admin"}}, ""},
+		{"decimal loopback", url.Values{"url": {"http://2130706433/"}}, ""},
+		{"private", url.Values{"url": {"http://192.168.0.1/"}}, ""},
+		{"credentials", url.Values{"url": {"https://relief.example@evil.example/"}}, ""},
+		{"unicode host", url.Values{"url": {"https://Bücher.example/?utm_source=x"}}, "https://xn--bcher-kva.example/?utm_source=x"},
+		{"strip tracking", url.Values{"url": {"https://relief.example/?utm_source=x&id=1&fbclid=y"}, "strip_tracking": {"true"}}, "https://relief.example/?id=1"},
+		{"mailto", url.Values{"url": {"mailto:help@relief.example"}}, "mailto:help@relief.example"},
+	}
 
-	location := w.Header().Get("Location")
-	if !strings.Contains(location, "error=") {
-		t.Error("expected error for short password")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &MockDatabase{}
+			s := newTestServer(db)
+
+			tt.form.Set("title", "Link")
+			req := httptest.NewRequest("POST", "/admin/links/add", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			s.HandleAddLink(w, req)
+
+			if tt.saved == "" {
+				if len(db.links) != 0 || !strings.Contains(w.Header().Get("Location"), "error=") {
+					t.Errorf("expected the URL to be rejected, got links %+v (redirect %q)", db.links, w.Header().Get("Location"))
+				}
+				return
+			}
+			if len(db.links) != 1 || db.links[0].URL != tt.saved {
+				t.Errorf("expected %q to be saved, got %+v (redirect %q)", tt.saved, db.links, w.Header().Get("Location"))
+			}
+		})
 	}
 }
 
-func TestRequireAuthMiddleware(t *testing.T) {
-	s := newTestServer(&MockDatabase{})
+func TestHandleUpdateProfileAndBannerURLPolicy(t *testing.T) {
+	db := &MockDatabase{}
+	s := newTestServer(db)
 
-	called := false
-	handler := s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		called = true
-	}))
+	post := func(handler http.HandlerFunc, form url.Values) string {
+		req := httptest.NewRequest("POST", "/admin", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Header().Get("Location")
+	}
 
-	// Without session - should redirect
-	req := httptest.NewRequest("GET", "/admin", nil)
+	if location := post(s.HandleUpdateProfile, url.Values{"name": {"A"}, "avatar": {"data:image/svg+xml,<svg onload=alert(1)>"}}); !strings.Contains(location, "error=") {
+		t.Errorf("expected data avatar to be rejected, got %q", location)
+	}
+	if location := post(s.HandleUpdateProfile, url.Values{"name": {"A"}, "avatar": {"mailto:a@b.example"}}); !strings.Contains(location, "error=") {
+		t.Errorf("expected mailto avatar to be rejected, got %q", location)
+	}
+	if db.profile.Name != "" {
+		t.Errorf("expected rejected profile not to be saved, got %+v", db.profile)
+	}
+	post(s.HandleUpdateProfile, url.Values{"name": {"A"}, "avatar": {""}})
+	if db.profile.Name != "A" || db.profile.Avatar != "" {
+		t.Errorf("expected an empty avatar to be allowed, got %+v", db.profile)
+	}
+
+	if location := post(s.HandleUpdateBanner, url.Values{"banner_text": {"Rally"}, "banner_link": {"http://169.254.169.254/"}}); !strings.Contains(location, "error=") {
+		t.Errorf("expected metadata address to be rejected, got %q", location)
+	}
+	post(s.HandleUpdateBanner, url.Values{"banner_text": {"Rally"}, "banner_link": {"HTTPS://Rally.Example/"}})
+	if db.banner.Link != "https://rally.example/" {
+		t.Errorf("expected normalized banner link, got %+v", db.banner)
+	}
+}
+
+func TestHandleEditLinkPage(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "abc", Title: "Old Title", URL: "https://example.com"}},
+	}
+	var rendered models.AdminPageData
+	s := newTestServer(db)
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered = data.(models.AdminPageData)
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", "/admin/links/edit?id=abc", nil)
 	w := httptest.NewRecorder()
-	handler.ServeHTTP(w, req)
 
-	if called {
-		t.Error("handler should not be called without valid session")
+	s.HandleEditLinkPage(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
 	}
-	if w.Code != http.StatusSeeOther {
-		t.Errorf("expected redirect, got %d", w.Code)
+	if rendered.EditLink == nil || rendered.EditLink.Title != "Old Title" {
+		t.Errorf("expected edit form to be pre-filled, got %+v", rendered.EditLink)
 	}
 
-	// With valid session
-	called = false
-	token := s.createSession()
-	req = httptest.NewRequest("GET", "/admin", nil)
-	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	// Unknown link
+	req = httptest.NewRequest("GET", "/admin/links/edit?id=missing", nil)
 	w = httptest.NewRecorder()
-	handler.ServeHTTP(w, req)
 
-	if !called {
-		t.Error("handler should be called with valid session")
+	s.HandleEditLinkPage(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected redirect, got %d", w.Code)
 	}
 }
 
-func TestCacheControlMiddleware(t *testing.T) {
-	s := newTestServer(&MockDatabase{})
-
-	handler := s.cacheControl(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
+func TestHandleEditLinkPageSelectsIcon(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "abc", Title: "Typo", URL: "https://example.com", Category: "news", Icon: models.DefaultIcon}},
+	}
+	s := newTestServer(db)
+	tmpl := template.Must(template.ParseFiles("../templates/admin.html"))
+	s.tmplFunc = tmpl.ExecuteTemplate
 
-	// Static file request
-	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	req := httptest.NewRequest("GET", "/admin/links/edit?id=abc", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, models.User{Username: "sam", Role: models.RoleEditor}))
 	w := httptest.NewRecorder()
-	handler.ServeHTTP(w, req)
 
-	cacheHeader := w.Header().Get("Cache-Control")
-	if !strings.Contains(cacheHeader, "max-age=86400") {
-		t.Errorf("expected cache header for static files, got %q", cacheHeader)
+	s.HandleEditLinkPage(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<option value="link" selected>`) {
+		t.Errorf("expected the link icon to be selected, got %s", body)
 	}
+	if !strings.Contains(body, `<option value="news" selected>`) {
+		t.Error("expected the news category to be selected")
+	}
+	if strings.Count(body, " selected>") != 2 {
+		t.Errorf("expected exactly one category and one icon to be selected")
+	}
+}
 
-	// Non-static request
+func TestHandleEditLink(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{
+			{ID: "abc", Title: "Old Title", URL: "https://example.com"},
+			{ID: "def", Title: "Other", URL: "https://example.org"},
+		},
+	}
+	s := newTestServer(db)
+
+	form := url.Values{}
+	form.Set("id", "abc")
+	form.Set("title", "New Title")
+	form.Set("url", "https://example.com/fixed")
+	form.Set("category", "news")
+	req := httptest.NewRequest("POST", "/admin/links/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.HandleEditLink(w, req)
+
+	location := w.Header().Get("Location")
+	if !strings.Contains(location, "message=") {
+		t.Errorf("expected success message in redirect URL, got %q", location)
+	}
+	if len(db.links) != 2 {
+		t.Fatalf("expected 2 links, got %d", len(db.links))
+	}
+	if db.links[0].ID != "abc" || db.links[0].Title != "New Title" || db.links[0].URL != "https://example.com/fixed" {
+		t.Errorf("expected link to be updated in place, got %+v", db.links[0])
+	}
+}
+
+func TestHandleEditLinkValidation(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "abc", Title: "Old Title", URL: "https://example.com"}},
+	}
+	s := newTestServer(db)
+
+	form := url.Values{}
+	form.Set("id", "abc")
+	form.Set("title", "")
+	form.Set("url", "https://example.com")
+	req := httptest.NewRequest("POST", "/admin/links/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.HandleEditLink(w, req)
+
+	location := w.Header().Get("Location")
+	if !strings.Contains(location, "/admin/links/edit?id=abc") || !strings.Contains(location, "error=") {
+		t.Errorf("expected redirect back to edit form with error, got %q", location)
+	}
+	if db.links[0].Title != "Old Title" {
+		t.Error("expected link to be unchanged")
+	}
+}
+
+func TestHandleEditLinkNotFound(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+
+	form := url.Values{}
+	form.Set("id", "missing")
+	form.Set("title", "Title")
+	form.Set("url", "https://example.com")
+	req := httptest.NewRequest("POST", "/admin/links/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.HandleEditLink(w, req)
+
+	location := w.Header().Get("Location")
+	if !strings.Contains(location, "error=Link+not+found") {
+		t.Errorf("expected not found error, got %q", location)
+	}
+}
+
+func linkIDs(links []models.Link) string {
+	ids := make([]string, len(links))
+	for i, l := range links {
+		ids[i] = l.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestHandleMoveLink(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{
+			{ID: "a", Featured: true},
+			{ID: "b"},
+			{ID: "c"},
+		},
+	}
+	s := newTestServer(db)
+
+	move := func(id, direction string) {
+		form := url.Values{}
+		form.Set("id", id)
+		form.Set("direction", direction)
+		req := httptest.NewRequest("POST", "/admin/links/move", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.HandleMoveLink(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("expected redirect, got %d", w.Code)
+		}
+	}
+
+	move("c", "up")
+	if got := linkIDs(db.links); got != "a,c,b" {
+		t.Errorf("expected order a,c,b, got %s", got)
+	}
+
+	// Moving past the featured group boundary is a no-op
+	move("c", "up")
+	if got := linkIDs(db.links); got != "a,c,b" {
+		t.Errorf("expected order a,c,b, got %s", got)
+	}
+
+	// Moving past the end is a no-op
+	move("b", "down")
+	if db.reorderCalls != 1 {
+		t.Errorf("expected 1 reorder, got %d", db.reorderCalls)
+	}
+}
+
+func TestHandleReorderLinks(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "a"}, {ID: "b"}, {ID: "c"}},
+	}
+	s := newTestServer(db)
+
+	reorder := func(ids ...string) string {
+		form := url.Values{"id": ids}
+		req := httptest.NewRequest("POST", "/admin/links/reorder", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.HandleReorderLinks(w, req)
+		return w.Header().Get("Location")
+	}
+
+	if location := reorder("c", "a", "b"); !strings.Contains(location, "message=") {
+		t.Errorf("expected success message, got %q", location)
+	}
+	if got := linkIDs(db.links); got != "c,a,b" {
+		t.Errorf("expected order c,a,b, got %s", got)
+	}
+
+	// Partial, duplicated or unknown orderings are rejected
+	for _, ids := range [][]string{{"a", "b"}, {"a", "a", "b"}, {"a", "b", "x"}} {
+		if location := reorder(ids...); !strings.Contains(location, "error=") {
+			t.Errorf("expected error for %v, got %q", ids, location)
+		}
+	}
+	if db.reorderCalls != 1 {
+		t.Errorf("expected 1 reorder, got %d", db.reorderCalls)
+	}
+}
+
+func TestHandleUpdatePasswordTooShort(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+
+	form := url.Values{}
+	form.Set("new_password", "12345") // Less than 6 chars
+	req := httptest.NewRequest("POST", "/admin/password", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.HandleUpdatePassword(w, req)
+
+	location := w.Header().Get("Location")
+	if !strings.Contains(location, "error=") {
+		t.Error("expected error for short password")
+	}
+	if !strings.Contains(location, "at+least+"+strconv.Itoa(MinPasswordLength)+"+characters") {
+		t.Errorf("expected the message to give the minimum length, got %q", location)
+	}
+}
+
+func TestRequireAuthMiddleware(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+
+	called := false
+	handler := s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	// Without session - should redirect
+	req := httptest.NewRequest("GET", "/admin", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if called {
+		t.Error("handler should not be called without valid session")
+	}
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected redirect, got %d", w.Code)
+	}
+
+	// With valid session
+	called = false
+	token := newSession(t, s, "admin")
+	req = httptest.NewRequest("GET", "/admin", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if !called {
+		t.Error("handler should be called with valid session")
+	}
+}
+
+func TestCacheControlMiddleware(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+
+	handler := s.cacheControl(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Static file request
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	cacheHeader := w.Header().Get("Cache-Control")
+	if !strings.Contains(cacheHeader, "max-age=86400") {
+		t.Errorf("expected cache header for static files, got %q", cacheHeader)
+	}
+
+	// Non-static request
 	req = httptest.NewRequest("GET", "/", nil)
 	w = httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
@@ -420,3 +1266,1348 @@ func TestCacheControlMiddleware(t *testing.T) {
 		t.Errorf("expected no-cache for non-static, got %q", cacheHeader)
 	}
 }
+
+func TestSecurityHeaders(t *testing.T) {
+	s := newTestServer(memory.New())
+	var rendered models.IndexPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered, _ = data.(models.IndexPageData)
+		return nil
+	}
+	handler := s.Routes()
+
+	get := func() http.Header {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		return w.Header()
+	}
+
+	h := get()
+	for name, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("expected %s %q, got %q", name, want, got)
+		}
+	}
+	if h.Get("Permissions-Policy") == "" {
+		t.Error("expected a Permissions-Policy header")
+	}
+	if h.Get("Strict-Transport-Security") != "" {
+		t.Error("expected no HSTS header when it isn't configured")
+	}
+
+	csp := h.Get("Content-Security-Policy")
+	if rendered.Nonce == "" || !strings.Contains(csp, "script-src 'nonce-"+rendered.Nonce+"'") {
+		t.Errorf("expected the page's nonce %q in the policy, got %q", rendered.Nonce, csp)
+	}
+	for _, directive := range []string{"object-src 'none'", "frame-ancestors 'none'", "img-src 'self' data: https:", "report-uri /csp-report"} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("expected %q in the policy, got %q", directive, csp)
+		}
+	}
+	if strings.Contains(csp, "unsafe-inline") || strings.Contains(csp, "unsafe-eval") {
+		t.Errorf("expected no unsafe sources, got %q", csp)
+	}
+
+	first := rendered.Nonce
+	get()
+	if rendered.Nonce == first {
+		t.Error("expected a fresh nonce for every request")
+	}
+
+	s.SetSecurityHeaders(365*24*time.Hour, true)
+	h = get()
+	if got := h.Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("unexpected HSTS header %q", got)
+	}
+	if h.Get("Content-Security-Policy") != "" || h.Get("Content-Security-Policy-Report-Only") == "" {
+		t.Errorf("expected the policy in report-only mode, got %v", h)
+	}
+}
+
+func TestHandleCSPReport(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+	handler := s.Routes()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"report-uri", "application/csp-report", `{"csp-report": {"document-uri": "https://standwithiran.org/", "violated-directive": "script-src-elem", "blocked-uri": "inline", "line-number": 12}}`, http.StatusNoContent},
+		{"reporting api", "application/reports+json", `[{"type": "csp-violation", "body": {"documentURL": "https://standwithiran.org/admin", "effectiveDirective": "style-src-attr", "blockedURL": "inline"}}, {"type": "deprecation", "body": {}}]`, http.StatusNoContent},
+		{"missing report", "application/csp-report", `{"other": {}}`, http.StatusBadRequest},
+		{"not json", "application/csp-report", `hello`, http.StatusBadRequest},
+		{"wrong content type", "text/plain", `{"csp-report": {}}`, http.StatusBadRequest},
+		{"too large", "application/csp-report", `{"csp-report": {"sample": "` + strings.Repeat("a", maxCSPReportSize) + `"}}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/csp-report", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestTruncateReportField(t *testing.T) {
+	long := strings.Repeat("é", maxCSPReportField)
+	got := truncateReportField(long)
+	if len(got) > maxCSPReportField || !utf8.ValidString(got) {
+		t.Errorf("expected a valid string of at most %d bytes, got %d bytes", maxCSPReportField, len(got))
+	}
+	if truncateReportField("short") != "short" {
+		t.Error("expected short values to be kept")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	db := &MockDatabase{schemaVersion: 13, latestSchemaVersion: 13}
+	s := newTestServer(db)
+	s.AddReadinessCheck("workers", func(ctx context.Context) error { return nil })
+	handler := s.Routes()
+
+	ready := func() (int, health.Report) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+		var report health.Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("expected a JSON report, got %q: %v", w.Body.String(), err)
+		}
+		return w.Code, report
+	}
+	failing := func(report health.Report) []string {
+		var names []string
+		for _, c := range report.Checks {
+			if c.Status != health.StatusOK {
+				names = append(names, c.Name)
+			}
+		}
+		return names
+	}
+
+	if code, report := ready(); code != http.StatusServiceUnavailable || report.Status != health.StatusDraining {
+		t.Errorf("expected not ready before the server listens, got %d %+v", code, report)
+	}
+
+	s.ready.Store(true)
+	code, report := ready()
+	if code != http.StatusOK || report.Status != health.StatusOK {
+		t.Errorf("expected ready, got %d %+v", code, report)
+	}
+	var names []string
+	for _, c := range report.Checks {
+		names = append(names, c.Name)
+	}
+	if !slices.Equal(names, []string{"database", "migrations", "workers"}) {
+		t.Errorf("unexpected checks %v", names)
+	}
+
+	db.pingErr = errors.New("connection refused")
+	code, report = ready()
+	if code != http.StatusServiceUnavailable || !slices.Equal(failing(report), []string{"database"}) || report.Checks[0].Error != "connection refused" {
+		t.Errorf("expected the database check to fail, got %d %+v", code, report)
+	}
+	db.pingErr = nil
+
+	db.schemaVersion = 12
+	if code, report := ready(); code != http.StatusServiceUnavailable || !slices.Equal(failing(report), []string{"migrations"}) {
+		t.Errorf("expected pending migrations to fail, got %d %+v", code, report)
+	}
+	db.schemaVersion = 14
+	if code, report := ready(); code != http.StatusOK {
+		t.Errorf("expected a newer schema to pass, got %d %+v", code, report)
+	}
+
+	s.Drain()
+	if code, report := ready(); code != http.StatusServiceUnavailable || report.Status != health.StatusDraining {
+		t.Errorf("expected not ready once draining, got %d %+v", code, report)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected /health to stay up while draining, got %d", w.Code)
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s := newTestServer(&MockDatabase{})
+	s.server = &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		_, _ = w.Write([]byte("done"))
+	})}
+
+	started := make(chan error, 1)
+	go func() { started <- s.Start() }()
+	for !s.ready.Load() {
+		select {
+		case err := <-started:
+			t.Fatalf("server failed to start: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-entered
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("expected Shutdown to wait for the in-flight request, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if s.ready.Load() {
+		t.Error("expected the server not to be ready while shutting down")
+	}
+
+	close(release)
+	if got := <-response; got != "done" {
+		t.Errorf("expected the in-flight request to complete, got %q", got)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("unexpected shutdown error %v", err)
+	}
+	if err := <-started; err != nil {
+		t.Errorf("expected Start to return nil after Shutdown, got %v", err)
+	}
+}
+
+func TestShutdownTimeoutClosesConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	entered := make(chan struct{})
+	s := newTestServer(&MockDatabase{})
+	s.server = &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-r.Context().Done()
+	})}
+
+	go func() { _ = s.Start() }()
+	for !s.ready.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/"); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err == nil {
+		t.Error("expected an error when requests outlast the drain timeout")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "abc", Title: "A", URL: "https://a.example"}},
+		stats: database.Stats{
+			Pool:  &database.PoolStats{MaxConns: 10, TotalConns: 3, IdleConns: 2, AcquiredConns: 1, AcquireCount: 42, AcquireDuration: 1500 * time.Millisecond},
+			Cache: []cache.EntityStats{{Entity: cache.EntityLinks, Hits: 7, Misses: 2}},
+		},
+	}
+	s := newTestServer(db)
+	handler := s.Routes()
+	newSession(t, s, "admin")
+
+	for _, path := range []string{"/", "/go/abc", "/go/abc", "/no/such/page"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`standwithiran_http_requests_total{method="GET",route="/",status="200"} 1`,
+		`standwithiran_http_requests_total{method="GET",route="/go/{id}",status="302"} 2`,
+		`standwithiran_http_requests_total{method="GET",route="unmatched",status="301"} 1`,
+		`standwithiran_http_request_duration_seconds_count{method="GET",route="/go/{id}"} 2`,
+		`standwithiran_cache_requests_total{entity="links",result="hit"} 7`,
+		`standwithiran_cache_requests_total{entity="links",result="miss"} 2`,
+		`standwithiran_db_pool_max_conns 10`,
+		`standwithiran_db_pool_acquired_conns 1`,
+		`standwithiran_db_pool_acquires_total 42`,
+		`standwithiran_db_pool_acquire_seconds_total 1.5`,
+		`standwithiran_sessions_active 1`,
+		`standwithiran_build_info{go_version="` + runtime.Version() + `",version="test"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics", want)
+		}
+	}
+
+	db.stats.Pool = nil
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(w.Body.String(), "standwithiran_db_pool_") {
+		t.Error("expected no pool metrics for a backend without a pool")
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+	s.SetMetricsToken("s3cret")
+	handler := s.Routes()
+
+	tests := map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"s3cret":        http.StatusUnauthorized,
+		"Basic s3cret":  http.StatusUnauthorized,
+		"Bearer s3cret": http.StatusOK,
+	}
+	for header, want := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Authorization %q: expected %d, got %d", header, want, w.Code)
+		}
+	}
+}
+
+func TestMetricMethod(t *testing.T) {
+	if got := metricMethod("POST"); got != "POST" {
+		t.Errorf("expected POST to be kept, got %q", got)
+	}
+	if got := metricMethod("BREW"); got != "OTHER" {
+		t.Errorf("expected unknown methods to be grouped, got %q", got)
+	}
+}
+
+func TestRoutesWithMemoryDatabase(t *testing.T) {
+	db := memory.New()
+	s := newTestServer(db)
+	handler := s.Routes()
+
+	post := func(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/admin/login", url.Values{"username": {memory.DefaultUsername}, "password": {memory.DefaultPassword}})
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("expected login to set a session cookie")
+	}
+	csrf := csrfToken(t, s, session.Value)
+
+	for _, title := range []string{"First", "Second"} {
+		post("/admin/links/add", url.Values{"title": {title}, "url": {"https://example.com/" + title}, "csrf_token": {csrf}}, session)
+	}
+
+	links, _ := db.GetLinks(context.Background())
+	if len(links) != 2 {
+		t.Fatalf("expected 2 links, got %d", len(links))
+	}
+
+	post("/admin/links/delete", url.Values{"id": {links[1].ID}, "csrf_token": {csrf}}, session)
+
+	remaining, _ := db.GetLinks(context.Background())
+	if len(remaining) != 1 || remaining[0].ID != links[0].ID {
+		t.Errorf("expected only %s to remain, got %+v", links[0].ID, remaining)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	db := &MockDatabase{
+		profile: models.Profile{Name: "Test Site"},
+		links:   []models.Link{{ID: "a", Title: "A", URL: "https://a.example"}},
+	}
+	s := newTestServer(db)
+
+	req := httptest.NewRequest("GET", "/admin/export", nil)
+	w := httptest.NewRecorder()
+
+	s.HandleExport(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Error("expected export to be served as an attachment")
+	}
+	if !strings.Contains(w.Body.String(), `"version": 2`) || !strings.Contains(w.Body.String(), "https://a.example") {
+		t.Errorf("unexpected export body %s", w.Body.String())
+	}
+}
+
+func TestHandleImportPreviewAndApply(t *testing.T) {
+	db := &MockDatabase{
+		profile: models.Profile{Name: "Old"},
+		links:   []models.Link{{ID: "a", Title: "A", URL: "https://a.example"}},
+	}
+	var rendered models.ImportPageData
+	s := newTestServer(db)
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered = data.(models.ImportPageData)
+		return nil
+	}
+
+	document := `{"version": 1, "profile": {"name": "New"}, "links": [{"id": "b", "title": "B", "url": "https://b.example"}]}`
+
+	// Preview leaves the database untouched
+	form := url.Values{"document": {document}}
+	req := httptest.NewRequest("POST", "/admin/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.HandleImport(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected preview page, got %d", w.Code)
+	}
+	if len(rendered.Diff.Added) != 1 || len(rendered.Diff.Removed) != 1 || len(rendered.Diff.Profile) != 1 {
+		t.Errorf("unexpected diff %+v", rendered.Diff)
+	}
+	if db.profile.Name != "Old" {
+		t.Error("expected preview not to modify the database")
+	}
+
+	// Apply replaces the content
+	form.Set("mode", "apply")
+	req = httptest.NewRequest("POST", "/admin/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.HandleImport(w, req)
+
+	if location := w.Header().Get("Location"); !strings.Contains(location, "message=") {
+		t.Errorf("expected success redirect, got %q", location)
+	}
+	if db.profile.Name != "New" || len(db.links) != 1 || db.links[0].ID != "b" {
+		t.Errorf("expected content to be replaced, got %+v %+v", db.profile, db.links)
+	}
+}
+
+func TestHandleImportInvalid(t *testing.T) {
+	db := &MockDatabase{profile: models.Profile{Name: "Old"}}
+	s := newTestServer(db)
+
+	form := url.Values{"document": {`{"version": 42}`}, "mode": {"apply"}}
+	req := httptest.NewRequest("POST", "/admin/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.HandleImport(w, req)
+
+	if location := w.Header().Get("Location"); !strings.Contains(location, "error=") {
+		t.Errorf("expected error redirect, got %q", location)
+	}
+	if db.profile.Name != "Old" {
+		t.Error("expected invalid import not to modify the database")
+	}
+}
+
+func TestHandleImportLinksCSV(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "x", Title: "Existing", URL: "https://existing.example"}},
+	}
+	var rendered models.CSVImportPageData
+	s := newTestServer(db)
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered = data.(models.CSVImportPageData)
+		return nil
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "links.csv")
+	_, _ = fw.Write([]byte("title,url,category,icon\nNew,https://new.example,fundraiser,money\nDup,https://existing.example,news,book\nBad,ftp://bad.example,news,book\n"))
+	_ = mw.Close()
+
+	req := httptest.NewRequest("POST", "/admin/links/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	s.HandleImportLinksCSV(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected result page, got %d (%s)", w.Code, w.Header().Get("Location"))
+	}
+	if len(rendered.Added) != 1 || len(rendered.Errors) != 2 {
+		t.Errorf("expected 1 added and 2 errors, got %+v", rendered)
+	}
+	if len(db.links) != 2 || db.links[1].Title != "New" || db.links[1].ID == "" {
+		t.Errorf("expected new link to be stored with an ID, got %+v", db.links)
+	}
+}
+
+func TestHandleLinkRedirect(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "abc", URL: "https://fundraiser.example/donate"}},
+	}
+	s := newTestServer(db)
+	handler := s.Routes()
+
+	req := httptest.NewRequest("GET", "/go/abc", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("expected 302, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "https://fundraiser.example/donate" {
+		t.Errorf("expected redirect to link URL, got %q", location)
+	}
+	if db.clicks["abc"] != 1 {
+		t.Errorf("expected 1 click to be recorded, got %d", db.clicks["abc"])
+	}
+
+	// Unknown links go back to the home page without recording anything
+	req = httptest.NewRequest("GET", "/go/missing", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if location := w.Header().Get("Location"); location != "/" {
+		t.Errorf("expected redirect home, got %q", location)
+	}
+	if len(db.clicks) != 1 {
+		t.Errorf("expected no click for unknown link, got %v", db.clicks)
+	}
+}
+
+func TestIndexRecordsPageView(t *testing.T) {
+	db := &MockDatabase{}
+	s := newTestServer(db)
+
+	var rendered models.IndexPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered = data.(models.IndexPageData)
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Referer", "https://www.instagram.com/p/abc")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	s.HandleIndex(httptest.NewRecorder(), req)
+
+	// Bots are not counted
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "Googlebot/2.1")
+	s.HandleIndex(httptest.NewRecorder(), req)
+
+	if rendered.From != "" {
+		t.Errorf("expected no referrer for the second request, got %q", rendered.From)
+	}
+	if err := s.analytics.Flush(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	want := models.AnalyticsCount{Day: time.Now().UTC().Format(time.DateOnly), Kind: models.AnalyticsView, Referrer: "instagram.com", Count: 1}
+	if len(db.analytics) != 1 || db.analytics[0] != want {
+		t.Errorf("expected %+v, got %+v", want, db.analytics)
+	}
+}
+
+func TestLinkRedirectRecordsReferrer(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{{ID: "abc", URL: "https://fundraiser.example/donate"}},
+	}
+	s := newTestServer(db)
+
+	click := func(query string) {
+		req := httptest.NewRequest("GET", "/go/abc?"+query, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		s.Routes().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	click("from=t.co&sig=" + s.signReferrer("t.co"))
+	click("from=spam.example")
+	click("from=spam.example&sig=" + s.signReferrer("t.co"))
+	click("from=spam.example&sig=forged")
+
+	_ = s.analytics.Flush(context.Background(), db)
+	clicks := map[string]int{}
+	for _, c := range db.analytics {
+		if c.Kind == models.AnalyticsClick {
+			clicks[c.Referrer] += c.Count
+		}
+	}
+	if len(clicks) != 2 || clicks["t.co"] != 1 || clicks[""] != 3 {
+		t.Errorf("expected one click from t.co and unsigned sources counted as direct, got %+v", clicks)
+	}
+}
+
+func TestHandleAnalytics(t *testing.T) {
+	today := time.Now().UTC().Format(time.DateOnly)
+	db := &MockDatabase{
+		analytics: []models.AnalyticsCount{
+			{Day: today, Kind: models.AnalyticsView, Referrer: "t.co", Count: 7},
+			{Day: "2000-01-01", Kind: models.AnalyticsView, Count: 100},
+		},
+	}
+	s := newTestServer(db)
+	s.retentionDays = 90
+
+	var rendered models.AnalyticsPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered = data.(models.AnalyticsPageData)
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", "/admin/analytics?days=7", nil)
+	w := httptest.NewRecorder()
+	s.HandleAnalytics(w, req)
+
+	if rendered.Days != 7 || rendered.Views != 7 || rendered.RetentionDays != 90 || len(rendered.Daily) != 7 {
+		t.Errorf("unexpected page data %+v", rendered)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/analytics?format=csv", nil)
+	w = httptest.NewRecorder()
+	s.HandleAnalytics(w, req)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("expected CSV content type, got %q", ct)
+	}
+	want := "day,referrer,views,clicks\n" + today + ",t.co,7,0\n"
+	if w.Body.String() != want {
+		t.Errorf("expected CSV %q, got %q", want, w.Body.String())
+	}
+}
+
+func TestHandleAnalyticsRequiresAuth(t *testing.T) {
+	s := newTestServer(&MockDatabase{})
+
+	req := httptest.NewRequest("GET", "/admin/analytics", nil)
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected redirect to login, got %d", w.Code)
+	}
+}
+
+func TestBrokenLinksFlaggedAndHidden(t *testing.T) {
+	db := &MockDatabase{
+		links: []models.Link{
+			{ID: "ok", Title: "OK", URL: "https://ok.example"},
+			{ID: "dead", Title: "Dead", URL: "https://dead.example"},
+		},
+		health: map[string]models.LinkHealth{
+			"dead": {LinkID: "dead", URL: "https://dead.example", StatusCode: 404, Failures: 3},
+		},
+	}
+	s := newTestServer(db)
+	s.SetLinkCheckPolicy(3, false)
+
+	var index models.IndexPageData
+	var admin models.AdminPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		switch d := data.(type) {
+		case models.IndexPageData:
+			index = d
+		case models.AdminPageData:
+			admin = d
+		}
+		return nil
+	}
+
+	s.HandleAdmin(httptest.NewRecorder(), httptest.NewRequest("GET", "/admin", nil))
+	if _, ok := admin.Broken["dead"]; !ok || len(admin.Broken) != 1 {
+		t.Errorf("expected dead link to be flagged, got %v", admin.Broken)
+	}
+
+	// Without auto-hide the public page still shows it
+	s.HandleIndex(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(index.Links) != 2 {
+		t.Errorf("expected both links, got %+v", index.Links)
+	}
+
+	s.SetLinkCheckPolicy(3, true)
+	s.HandleIndex(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(index.Links) != 1 || index.Links[0].ID != "ok" {
+		t.Errorf("expected dead link to be hidden, got %+v", index.Links)
+	}
+}
+
+func TestScheduledLinks(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	db := &MockDatabase{
+		links: []models.Link{
+			{ID: "live", Title: "Live", URL: "https://live.example", ExpiresAt: &future},
+			{ID: "upcoming", Title: "Upcoming", URL: "https://upcoming.example", PublishAt: &future},
+			{ID: "expired", Title: "Expired", URL: "https://expired.example", ExpiresAt: &past},
+		},
+	}
+	s := newTestServer(db)
+
+	var index models.IndexPageData
+	var admin models.AdminPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		switch d := data.(type) {
+		case models.IndexPageData:
+			index = d
+		case models.AdminPageData:
+			admin = d
+		}
+		return nil
+	}
+
+	s.HandleIndex(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(index.Links) != 1 || index.Links[0].ID != "live" {
+		t.Errorf("expected only the live link on the public page, got %+v", index.Links)
+	}
+
+	s.HandleAdmin(httptest.NewRecorder(), httptest.NewRequest("GET", "/admin", nil))
+	if len(admin.Links) != 3 {
+		t.Errorf("expected the admin list to show every link, got %+v", admin.Links)
+	}
+	if got := admin.Links[1].Status(admin.Now); got != models.LinkScheduled {
+		t.Errorf("expected scheduled status, got %q", got)
+	}
+	if got := admin.Links[2].Status(admin.Now); got != models.LinkExpired {
+		t.Errorf("expected expired status, got %q", got)
+	}
+
+	// Expired links no longer redirect
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, httptest.NewRequest("GET", "/go/expired", nil))
+	if location := w.Header().Get("Location"); location != "/" {
+		t.Errorf("expected expired link to redirect home, got %q", location)
+	}
+}
+
+func TestHandleEditLinkSchedule(t *testing.T) {
+	db := &MockDatabase{links: []models.Link{{ID: "a", Title: "A", URL: "https://a.example"}}}
+	s := newTestServer(db)
+
+	form := url.Values{}
+	form.Set("id", "a")
+	form.Set("title", "Rally")
+	form.Set("url", "https://a.example")
+	form.Set("publish_at", "2026-03-01T09:00")
+	form.Set("expires_at", "2026-03-08T18:30")
+	req := httptest.NewRequest("POST", "/admin/links/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.HandleEditLink(w, req)
+
+	l := db.links[0]
+	if l.PublishAt == nil || !l.PublishAt.Equal(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected publish time %v", l.PublishAt)
+	}
+	if l.ExpiresAt == nil || !l.ExpiresAt.Equal(time.Date(2026, 3, 8, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry time %v", l.ExpiresAt)
+	}
+
+	// Expiry before publishing is rejected
+	form.Set("expires_at", "2026-02-01T00:00")
+	req = httptest.NewRequest("POST", "/admin/links/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.HandleEditLink(w, req)
+
+	if location := w.Header().Get("Location"); !strings.Contains(location, "error=") {
+		t.Errorf("expected an error redirect, got %q", location)
+	}
+}
+
+func TestIndexShowsHighestPriorityBanner(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	db := &MockDatabase{
+		banner: models.Banner{Enabled: true, Text: "Default", Type: "info"},
+		banners: []models.ScheduledBanner{
+			{ID: "low", Text: "Low", Type: "info", Priority: 1},
+			{ID: "high", Text: "Rally at 3pm", Type: "urgent", Priority: 5, StartsAt: &past},
+			{ID: "later", Text: "Tomorrow", Type: "urgent", Priority: 9, StartsAt: &future},
+			{ID: "over", Text: "Over", Type: "urgent", Priority: 9, EndsAt: &past},
+		},
+	}
+	s := newTestServer(db)
+
+	var index models.IndexPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		index = data.(models.IndexPageData)
+		return nil
+	}
+
+	s.HandleIndex(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !index.Banner.Enabled || index.Banner.Text != "Rally at 3pm" {
+		t.Errorf("expected the highest-priority active banner, got %+v", index.Banner)
+	}
+
+	// With nothing active the default banner is shown
+	db.banners = db.banners[2:]
+	s.HandleIndex(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if index.Banner.Text != "Default" {
+		t.Errorf("expected the default banner, got %+v", index.Banner)
+	}
+}
+
+func TestHandleBanners(t *testing.T) {
+	now := time.Now()
+	past, future, later := now.Add(-time.Hour), now.Add(time.Hour), now.Add(2*time.Hour)
+	db := &MockDatabase{
+		banners: []models.ScheduledBanner{
+			{ID: "later", StartsAt: &later},
+			{ID: "soon", StartsAt: &future},
+			{ID: "on", Priority: 1},
+			{ID: "top", Priority: 2},
+			{ID: "over", EndsAt: &past},
+		},
+	}
+	s := newTestServer(db)
+
+	var rendered models.BannersPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		rendered = data.(models.BannersPageData)
+		return nil
+	}
+
+	s.HandleBanners(httptest.NewRecorder(), httptest.NewRequest("GET", "/admin/banners", nil))
+
+	ids := func(banners []models.ScheduledBanner) string {
+		var out []string
+		for _, b := range banners {
+			out = append(out, b.ID)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := ids(rendered.Active); got != "top,on" {
+		t.Errorf("expected active banners top,on, got %s", got)
+	}
+	if got := ids(rendered.Upcoming); got != "soon,later" {
+		t.Errorf("expected upcoming banners soon,later, got %s", got)
+	}
+	if got := ids(rendered.Past); got != "over" {
+		t.Errorf("expected past banner over, got %s", got)
+	}
+}
+
+func TestHandleAddBanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		form  url.Values
+		added bool
+	}{
+		{"valid", url.Values{"text": {"Rally"}, "type": {"urgent"}, "priority": {"3"}, "starts_at": {"2026-03-01T15:00"}, "ends_at": {"2026-03-01T18:00"}}, true},
+		{"missing text", url.Values{"text": {" "}, "type": {"info"}}, false},
+		{"bad style", url.Values{"text": {"Rally"}, "type": {"blink"}}, false},
+		{"bad priority", url.Values{"text": {"Rally"}, "type": {"info"}, "priority": {"high"}}, false},
+		{"ends before start", url.Values{"text": {"Rally"}, "type": {"info"}, "starts_at": {"2026-03-02T00:00"}, "ends_at": {"2026-03-01T00:00"}}, false},
+		{"script link", url.Values{"text": {"Rally"}, "type": {"info"}, "link": {"javascript:alert(1)"}}, false},
+		{"local link", url.Values{"text": {"Rally"}, "type": {"info"}, "link": {"http://localhost/"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &MockDatabase{}
+			s := newTestServer(db)
+
+			req := httptest.NewRequest("POST", "/admin/banners/add", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			s.HandleAddBanner(w, req)
+
+			if added := len(db.banners) == 1; added != tt.added {
+				t.Fatalf("expected added=%v, got banners %+v (redirect %q)", tt.added, db.banners, w.Header().Get("Location"))
+			}
+			if tt.added {
+				b := db.banners[0]
+				if b.ID == "" || b.Priority != 3 || b.StartsAt == nil || b.EndsAt == nil {
+					t.Errorf("unexpected banner %+v", b)
+				}
+			}
+		})
+	}
+}
+
+func TestRoleAccess(t *testing.T) {
+	db := &MockDatabase{users: []models.User{
+		{Username: "olive", Role: models.RoleOwner},
+		{Username: "eddie", Role: models.RoleEditor},
+		{Username: "vera", Role: models.RoleViewer},
+	}}
+	s := newTestServer(db)
+	handler := s.Routes()
+
+	tests := []struct {
+		user    string
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"vera", "GET", "/admin", true},
+		{"vera", "GET", "/admin/analytics", true},
+		{"vera", "POST", "/admin/password", true},
+		{"vera", "POST", "/admin/links/add", false},
+		{"vera", "POST", "/admin/banners/delete", false},
+		{"eddie", "POST", "/admin/links/add", true},
+		{"eddie", "POST", "/admin/import", true},
+		{"eddie", "GET", "/admin/users", false},
+		{"eddie", "POST", "/admin/users/add", false},
+		{"eddie", "GET", "/admin/login-failures", false},
+		{"olive", "GET", "/admin/login-failures", true},
+		{"olive", "GET", "/admin/users", true},
+		{"olive", "POST", "/admin/links/add", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.path, func(t *testing.T) {
+			token := newSession(t, s, tt.user)
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: token})
+			req.Header.Set(csrfHeader, csrfToken(t, s, token))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if allowed := w.Code != http.StatusForbidden; allowed != tt.allowed {
+				t.Errorf("expected allowed=%v, got status %d", tt.allowed, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireAuthDeletedUser(t *testing.T) {
+	db := &MockDatabase{users: []models.User{{Username: "sam", Role: models.RoleEditor}}}
+	s := newTestServer(db)
+	token := newSession(t, s, "sam")
+	db.users = nil
+
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin/login" {
+		t.Errorf("expected redirect to login, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if s.validateSession(context.Background(), token) {
+		t.Error("expected the deleted user's session to be dropped")
+	}
+}
+
+func TestHandleUsers(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		form  url.Values
+		error string
+	}{
+		{"add", "/admin/users/add", url.Values{"username": {" Sam "}, "password": {"secret-pw"}, "role": {"editor"}}, ""},
+		{"add bad name", "/admin/users/add", url.Values{"username": {"s@m"}, "password": {"secret-pw"}, "role": {"editor"}}, "Usernames"},
+		{"add bad role", "/admin/users/add", url.Values{"username": {"sam"}, "password": {"secret-pw"}, "role": {"admin"}}, "Invalid+role"},
+		{"add short password", "/admin/users/add", url.Values{"username": {"sam"}, "password": {"123"}, "role": {"viewer"}}, "Password"},
+		{"add taken", "/admin/users/add", url.Values{"username": {"admin"}, "password": {"secret-pw"}, "role": {"viewer"}}, "taken"},
+		{"delete self", "/admin/users/delete", url.Values{"username": {"admin"}}, "own+account"},
+		{"delete unknown", "/admin/users/delete", url.Values{"username": {"nobody"}}, "not+found"},
+		{"role unknown", "/admin/users/role", url.Values{"username": {"nobody"}, "role": {"viewer"}}, "not+found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &MockDatabase{}
+			s := newTestServer(db)
+
+			token := newSession(t, s, "admin")
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set(csrfHeader, csrfToken(t, s, token))
+			req.AddCookie(&http.Cookie{Name: "session", Value: token})
+			w := httptest.NewRecorder()
+			s.Routes().ServeHTTP(w, req)
+
+			location := w.Header().Get("Location")
+			if tt.error == "" {
+				if strings.Contains(location, "error=") {
+					t.Fatalf("unexpected error redirect %q", location)
+				}
+				if _, err := db.GetUser(context.Background(), "sam"); err != nil {
+					t.Errorf("expected sam to be added, got %v", err)
+				}
+				return
+			}
+			if !strings.Contains(location, "error=") || !strings.Contains(location, tt.error) {
+				t.Errorf("expected error containing %q, got %q", tt.error, location)
+			}
+		})
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	db := memory.New()
+	ctx := context.Background()
+	secret, _ := totp.GenerateSecret()
+	step := totp.Counter(time.Now())
+	if err := db.EnableTOTP(ctx, memory.DefaultUsername, secret, step-2, []string{totp.HashRecoveryCode("abcde-fghij")}); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(db)
+	handler := s.Routes()
+
+	post := func(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name && c.Value != "" {
+				return c
+			}
+		}
+		return nil
+	}
+	login := func() *http.Cookie {
+		t.Helper()
+		w := post("/admin/login", url.Values{"username": {memory.DefaultUsername}, "password": {memory.DefaultPassword}})
+		if w.Header().Get("Location") != "/admin/login/2fa" || cookie(w, "session") != nil {
+			t.Fatalf("expected password step to ask for a code, got %q", w.Header().Get("Location"))
+		}
+		return cookie(w, "login_2fa")
+	}
+
+	pending := login()
+	if w := post("/admin/login/2fa", url.Values{"code": {"000000"}}, pending); cookie(w, "session") != nil {
+		t.Fatal("expected a wrong code to be rejected")
+	}
+
+	code, _ := totp.Code(secret, step)
+	w := post("/admin/login/2fa", url.Values{"code": {code}}, pending)
+	if cookie(w, "session") == nil {
+		t.Fatalf("expected a current code to sign in, got status %d", w.Code)
+	}
+	if w := post("/admin/login/2fa", url.Values{"code": {code}}, pending); cookie(w, "session") != nil {
+		t.Error("expected the pending login to be used up")
+	}
+
+	if w := post("/admin/login/2fa", url.Values{"code": {code}}, login()); cookie(w, "session") != nil {
+		t.Error("expected a replayed code to be rejected")
+	}
+
+	if w := post("/admin/login/2fa", url.Values{"code": {"ABCDE FGHIJ"}}, login()); cookie(w, "session") == nil {
+		t.Error("expected a recovery code to sign in")
+	}
+	if w := post("/admin/login/2fa", url.Values{"code": {"abcde-fghij"}}, login()); cookie(w, "session") != nil {
+		t.Error("expected a recovery code to work only once")
+	}
+
+	pending = login()
+	for range secondFactorAttempts {
+		post("/admin/login/2fa", url.Values{"code": {"000000"}}, pending)
+	}
+	next, _ := totp.Code(secret, step+1)
+	if w := post("/admin/login/2fa", url.Values{"code": {next}}, pending); cookie(w, "session") != nil {
+		t.Error("expected the pending login to be dropped after too many wrong codes")
+	}
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	db := memory.New()
+	s := newTestServer(db)
+	handler := s.Routes()
+	session := &http.Cookie{Name: "session", Value: newSession(t, s, memory.DefaultUsername)}
+
+	var page models.TwoFactorPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		page = data.(models.TwoFactorPageData)
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", "/admin/2fa", nil)
+	req.AddCookie(session)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if page.Secret == "" {
+		t.Fatal("expected a secret to enroll with")
+	}
+
+	if !strings.HasPrefix(string(page.QRCode), "data:image/png;base64,") {
+		t.Errorf("expected an inline PNG QR code, got %.40q", page.QRCode)
+	}
+
+	code, _ := totp.Code(page.Secret, totp.Counter(time.Now()))
+	form := url.Values{"secret": {page.Secret}, "code": {code}, "csrf_token": {page.CSRFToken}}
+	req = httptest.NewRequest("POST", "/admin/2fa/enable", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(session)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(page.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes to be shown, got %d", recoveryCodeCount, len(page.RecoveryCodes))
+	}
+	if u, _ := db.GetUser(context.Background(), memory.DefaultUsername); !u.TwoFactor {
+		t.Error("expected two-factor authentication to be on")
+	}
+	if ok, _ := db.UseRecoveryCode(context.Background(), memory.DefaultUsername, totp.HashRecoveryCode(page.RecoveryCodes[0])); !ok {
+		t.Error("expected the shown recovery codes to be stored")
+	}
+}
+
+func TestSessionManagement(t *testing.T) {
+	db := memory.New()
+	ctx := context.Background()
+	if err := db.AddUser(ctx, models.User{Username: "vera", Role: models.RoleViewer}, "secret-pw"); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(db)
+	handler := s.Routes()
+
+	var page models.SessionsPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		if p, ok := data.(models.SessionsPageData); ok {
+			page = p
+		}
+		return nil
+	}
+	request := func(method, path string, form url.Values, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrfToken(t, s, token))
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest("POST", "/admin/login", nil)
+	req.RemoteAddr = "203.0.113.77:5555"
+	req.Header.Set("User-Agent", "Laptop Browser")
+	laptop, err := s.createSession(req, "vera")
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone := newSession(t, s, "vera")
+	admin := newSession(t, s, memory.DefaultUsername)
+
+	request("GET", "/admin/sessions", nil, phone)
+	if len(page.Sessions) != 2 {
+		t.Fatalf("expected a viewer to see only their 2 sessions, got %d", len(page.Sessions))
+	}
+	var laptopID string
+	for _, sess := range page.Sessions {
+		if sess.UserAgent == "Laptop Browser" {
+			laptopID = sess.ID
+			if sess.Address != "203.0.113.0/24" {
+				t.Errorf("expected a coarse address, got %q", sess.Address)
+			}
+		}
+	}
+	if laptopID == "" || laptopID == laptop {
+		t.Fatalf("expected the laptop session listed by ID, got %+v", page.Sessions)
+	}
+
+	request("GET", "/admin/sessions", nil, admin)
+	if len(page.Sessions) != 3 {
+		t.Errorf("expected an owner to see all 3 sessions, got %d", len(page.Sessions))
+	}
+	adminID := page.CurrentID
+
+	w := request("POST", "/admin/sessions/revoke", url.Values{"id": {adminID}}, phone)
+	if !strings.Contains(w.Header().Get("Location"), "error=") || !s.validateSession(ctx, admin) {
+		t.Error("expected a viewer not to revoke someone else's session")
+	}
+
+	request("POST", "/admin/sessions/revoke", url.Values{"id": {laptopID}}, phone)
+	if s.validateSession(ctx, laptop) || !s.validateSession(ctx, phone) {
+		t.Error("expected only the laptop session to be revoked")
+	}
+
+	laptop = newSession(t, s, "vera")
+	w = request("POST", "/admin/password", url.Values{"new_password": {"new-secret"}}, phone)
+	if !strings.Contains(w.Header().Get("Location"), "signed+out") {
+		t.Errorf("expected the password change to mention revoked sessions, got %q", w.Header().Get("Location"))
+	}
+	if s.validateSession(ctx, laptop) || !s.validateSession(ctx, phone) {
+		t.Error("expected a password change to revoke only the other sessions")
+	}
+
+	w = request("POST", "/admin/sessions/revoke-all", nil, phone)
+	if w.Header().Get("Location") != "/admin/login" || s.validateSession(ctx, phone) {
+		t.Error("expected log out everywhere to end the current session too")
+	}
+	if !s.validateSession(ctx, admin) {
+		t.Error("expected other users' sessions to survive log out everywhere")
+	}
+}
+
+func TestResetUserTwoFactorRevokesSessions(t *testing.T) {
+	db := memory.New()
+	ctx := context.Background()
+	if err := db.AddUser(ctx, models.User{Username: "vera", Role: models.RoleEditor}, "secret-pw"); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(db)
+	handler := s.Routes()
+
+	laptop := newSession(t, s, "vera")
+	phone := newSession(t, s, "vera")
+	admin := newSession(t, s, memory.DefaultUsername)
+	adminPhone := newSession(t, s, memory.DefaultUsername)
+
+	reset := func(username string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {username}}
+		req := httptest.NewRequest("POST", "/admin/users/2fa", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrfToken(t, s, admin))
+		req.AddCookie(&http.Cookie{Name: "session", Value: admin})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := reset("vera"); !strings.Contains(w.Header().Get("Location"), "message=") {
+		t.Fatalf("expected the reset to succeed, got %q", w.Header().Get("Location"))
+	}
+	if s.validateSession(ctx, laptop) || s.validateSession(ctx, phone) {
+		t.Error("expected a two-factor reset to sign the user out everywhere")
+	}
+	if !s.validateSession(ctx, admin) || !s.validateSession(ctx, adminPhone) {
+		t.Error("expected other users' sessions to survive")
+	}
+
+	reset(memory.DefaultUsername)
+	if !s.validateSession(ctx, admin) || s.validateSession(ctx, adminPhone) {
+		t.Error("expected resetting your own two-factor to keep only the current session")
+	}
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	db := memory.New()
+	s := newTestServer(db)
+	handler := s.Routes()
+	token := newSession(t, s, memory.DefaultUsername)
+	other := newSession(t, s, memory.DefaultUsername)
+
+	var rendered models.ErrorPageData
+	s.tmplFunc = func(wr io.Writer, name string, data any) error {
+		if p, ok := data.(models.ErrorPageData); ok {
+			rendered = p
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		header  string
+		allowed bool
+	}{
+		{"missing", url.Values{}, "", false},
+		{"empty", url.Values{"csrf_token": {""}}, "", false},
+		{"forged", url.Values{"csrf_token": {strings.Repeat("0", 64)}}, "", false},
+		{"other session", url.Values{"csrf_token": {csrfToken(t, s, other)}}, "", false},
+		{"form field", url.Values{"csrf_token": {csrfToken(t, s, token)}}, "", true},
+		{"header", url.Values{}, csrfToken(t, s, token), true},
+		{"forged header", url.Values{"csrf_token": {csrfToken(t, s, token)}}, "forged", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered = models.ErrorPageData{}
+			tt.form.Set("title", tt.name)
+			tt.form.Set("url", "https://example.com/"+strings.ReplaceAll(tt.name, " ", "-"))
+			req := httptest.NewRequest("POST", "/admin/links/add", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				req.Header.Set(csrfHeader, tt.header)
+			}
+			req.AddCookie(&http.Cookie{Name: "session", Value: token})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			links, _ := db.GetLinks(context.Background())
+			added := slices.ContainsFunc(links, func(l models.Link) bool { return l.Title == tt.name })
+			if added != tt.allowed {
+				t.Errorf("expected allowed=%v, got status %d", tt.allowed, w.Code)
+			}
+			if !tt.allowed && (w.Code != http.StatusForbidden || rendered.Status != http.StatusForbidden) {
+				t.Errorf("expected the 403 error page, got %d %+v", w.Code, rendered)
+			}
+		})
+	}
+
+	t.Run("multipart", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("csrf_token", csrfToken(t, s, token))
+		fw, _ := mw.CreateFormFile("file", "links.csv")
+		_, _ = fw.Write([]byte("title,url\nUploaded,https://example.com/uploaded\n"))
+		_ = mw.Close()
+
+		req := httptest.NewRequest("POST", "/admin/links/import", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected an upload with a valid token to be imported, got %d", w.Code)
+		}
+	})
+
+	t.Run("safe methods", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected GET to need no token, got %d", w.Code)
+		}
+	})
+}
@@ -1,49 +1,119 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/session"
+)
+
+const (
+	sessionDuration = 24 * time.Hour
+	// lastSeenInterval limits how often a session's last-seen time is
+	// written back, so browsing the admin panel isn't a write per request.
+	lastSeenInterval   = time.Minute
+	maxUserAgentLength = 256
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	sessionContextKey
+	nonceContextKey
 )
 
-func (s *Server) createSession() string {
+func newToken() string {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
 		panic("failed to generate session token: " + err.Error())
 	}
-	token := hex.EncodeToString(bytes)
+	return hex.EncodeToString(bytes)
+}
 
-	s.sessionsMu.Lock()
-	s.sessions[token] = time.Now().Add(24 * time.Hour)
-	s.sessionsMu.Unlock()
+// userAgent returns the request's user agent, cut short enough to store.
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = strings.ToValidUTF8(ua[:maxUserAgentLength], "")
+	}
+	return ua
+}
 
-	return token
+// newClientSession describes a session for username signing in with r.
+func newClientSession(r *http.Request, username string, lifetime time.Duration) models.Session {
+	now := time.Now()
+	return models.Session{
+		Username:   username,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(lifetime),
+		UserAgent:  userAgent(r),
+		Address:    session.CoarseAddress(r.RemoteAddr),
+		CSRFToken:  newToken(),
+	}
 }
 
-func (s *Server) validateSession(token string) bool {
-	s.sessionsMu.RLock()
-	expiry, exists := s.sessions[token]
-	s.sessionsMu.RUnlock()
+func (s *Server) createSession(r *http.Request, username string) (string, error) {
+	token := newToken()
+	err := s.sessions.Create(r.Context(), token, newClientSession(r, username, sessionDuration))
+	return token, err
+}
 
-	if !exists {
-		return false
+// startSession signs username in and sends them to the admin panel.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, username string) {
+	token, err := s.createSession(r, username)
+	if err != nil {
+		slog.Error("Failed to create session", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
 	}
 
-	if time.Now().After(expiry) {
-		s.sessionsMu.Lock()
-		delete(s.sessions, token)
-		s.sessionsMu.Unlock()
-		return false
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   int(sessionDuration / time.Second),
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// loadSession returns the signed-in session for token. Unknown, expired and
+// pending sessions report session.ErrNotFound.
+func (s *Server) loadSession(ctx context.Context, token string) (models.Session, error) {
+	if token == "" {
+		return models.Session{}, session.ErrNotFound
+	}
+	sess, err := s.sessions.Get(ctx, token)
+	if err != nil {
+		return models.Session{}, err
 	}
+	if sess.Pending {
+		return models.Session{}, session.ErrNotFound
+	}
+	return sess, nil
+}
 
-	return true
+func (s *Server) validateSession(ctx context.Context, token string) bool {
+	_, err := s.loadSession(ctx, token)
+	return err == nil
 }
 
-func (s *Server) deleteSession(token string) {
-	s.sessionsMu.Lock()
-	delete(s.sessions, token)
-	s.sessionsMu.Unlock()
+func (s *Server) deleteSession(ctx context.Context, token string) {
+	if err := s.sessions.Delete(ctx, token); err != nil {
+		slog.Error("Failed to delete session", "error", err)
+	}
 }
 
 func (s *Server) getSessionFromRequest(r *http.Request) string {
@@ -54,13 +124,74 @@ func (s *Server) getSessionFromRequest(r *http.Request) string {
 	return cookie.Value
 }
 
+// currentUser returns the user RequireAuth attached to the request.
+func currentUser(r *http.Request) models.User {
+	u, _ := r.Context().Value(userContextKey).(models.User)
+	return u
+}
+
+// currentSession returns the session RequireAuth attached to the request.
+func currentSession(r *http.Request) models.Session {
+	sess, _ := r.Context().Value(sessionContextKey).(models.Session)
+	return sess
+}
+
+// RequireAuth loads the session's user on every request so that role
+// changes and deleted accounts take effect without waiting for the session
+// to expire.
 func (s *Server) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := s.getSessionFromRequest(r)
-		if !s.validateSession(token) {
+		sess, err := s.loadSession(r.Context(), token)
+		if errors.Is(err, session.ErrNotFound) {
 			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
 			return
 		}
-		next.ServeHTTP(w, r)
+		if err != nil {
+			slog.Error("Failed to load session", "error", err)
+			s.renderError(w, http.StatusInternalServerError)
+			return
+		}
+
+		user, err := s.db.GetUser(r.Context(), sess.Username)
+		if errors.Is(err, database.ErrUserNotFound) {
+			s.deleteSession(r.Context(), token)
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to load user", "error", err)
+			s.renderError(w, http.StatusInternalServerError)
+			return
+		}
+
+		// Sessions from before CSRF tokens existed get one on first use
+		if now := time.Now(); now.Sub(sess.LastSeenAt) >= lastSeenInterval || sess.CSRFToken == "" {
+			sess.LastSeenAt = now
+			if sess.CSRFToken == "" {
+				sess.CSRFToken = newToken()
+			}
+			if err := s.sessions.Update(r.Context(), token, sess); err != nil {
+				slog.Error("Failed to update session", "error", err)
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, sessionContextKey, sess)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireRole rejects requests from users below role. It must run after
+// RequireAuth.
+func (s *Server) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !currentUser(r).Can(role) {
+				s.renderErrorMessage(w, http.StatusForbidden, "Your account doesn't have access to this page.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
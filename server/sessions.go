@@ -0,0 +1,109 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+// visibleSessions returns the sessions user may see and revoke: their own,
+// or everyone's for owners.
+func (s *Server) visibleSessions(r *http.Request, user models.User) ([]models.Session, error) {
+	sessions, err := s.sessions.List(r.Context())
+	if err != nil || user.Can(models.RoleOwner) {
+		return sessions, err
+	}
+	return slices.DeleteFunc(sessions, func(sess models.Session) bool {
+		return sess.Username != user.Username
+	}), nil
+}
+
+func (s *Server) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	sessions, err := s.visibleSessions(r, user)
+	if err != nil {
+		slog.Error("Failed to list sessions", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	data := models.SessionsPageData{
+		User:      user,
+		CSRFToken: currentSession(r).CSRFToken,
+		Sessions:  sessions,
+		CurrentID: currentSession(r).ID,
+		Message:   r.URL.Query().Get("message"),
+		Error:     r.URL.Query().Get("error"),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "sessions.html", data); err != nil {
+		slog.Error("Failed to render sessions template", "error", err)
+	}
+}
+
+func (s *Server) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+
+	sessions, err := s.visibleSessions(r, currentUser(r))
+	if err != nil {
+		slog.Error("Failed to list sessions", "error", err)
+		http.Redirect(w, r, "/admin/sessions?error=Failed+to+revoke+session", http.StatusSeeOther)
+		return
+	}
+	if !slices.ContainsFunc(sessions, func(sess models.Session) bool { return sess.ID == id }) {
+		http.Redirect(w, r, "/admin/sessions?error=Session+not+found", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.sessions.Revoke(r.Context(), id); err != nil {
+		slog.Error("Failed to revoke session", "error", err)
+		http.Redirect(w, r, "/admin/sessions?error=Failed+to+revoke+session", http.StatusSeeOther)
+		return
+	}
+
+	if id == currentSession(r).ID {
+		s.signOut(w, r)
+		return
+	}
+	http.Redirect(w, r, "/admin/sessions?message=Session+revoked", http.StatusSeeOther)
+}
+
+// HandleRevokeAllSessions logs the current user out everywhere, including
+// this browser.
+func (s *Server) HandleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.sessions.RevokeUser(r.Context(), currentUser(r).Username, ""); err != nil {
+		slog.Error("Failed to revoke sessions", "error", err)
+		http.Redirect(w, r, "/admin/sessions?error=Failed+to+log+out+everywhere", http.StatusSeeOther)
+		return
+	}
+	s.signOut(w, r)
+}
+
+// signOut clears the session cookie after its session has been revoked.
+func (s *Server) signOut(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// revokeOtherSessions signs username out of every session but the current
+// one, after a change like a new password, and reports how many it removed.
+func (s *Server) revokeOtherSessions(r *http.Request, username string) int {
+	keep := ""
+	if username == currentUser(r).Username {
+		keep = currentSession(r).ID
+	}
+	n, err := s.sessions.RevokeUser(r.Context(), username, keep)
+	if err != nil {
+		slog.Error("Failed to revoke sessions", "error", err)
+	}
+	return n
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alexraskin/standwithiran/internal/models"
+	"github.com/alexraskin/standwithiran/internal/session"
+	"github.com/alexraskin/standwithiran/internal/totp"
+)
+
+const (
+	// totpIssuer is the account name authenticator apps show.
+	totpIssuer = "Stand With Iran"
+	// secondFactorTimeout is how long a correct password is remembered
+	// while waiting for the code.
+	secondFactorTimeout = 5 * time.Minute
+	// secondFactorAttempts is how many wrong codes are allowed before the
+	// password has to be entered again.
+	secondFactorAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+// startSecondFactor records that username got their password right with a
+// pending session and asks for a code before a real session is created.
+// Keeping it in the session store lets any replica finish the login.
+func (s *Server) startSecondFactor(w http.ResponseWriter, r *http.Request, username string) {
+	token := newToken()
+	pending := newClientSession(r, username, secondFactorTimeout)
+	pending.Pending = true
+	if err := s.sessions.Create(r.Context(), token, pending); err != nil {
+		slog.Error("Failed to create session", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_2fa",
+		Value:    token,
+		Path:     "/admin/login",
+		HttpOnly: true,
+		MaxAge:   int(secondFactorTimeout / time.Second),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/admin/login/2fa", http.StatusSeeOther)
+}
+
+// pendingSession returns the pending session named by the request's second
+// factor cookie.
+func (s *Server) pendingSession(r *http.Request) (string, models.Session, error) {
+	cookie, err := r.Cookie("login_2fa")
+	if err != nil {
+		return "", models.Session{}, session.ErrNotFound
+	}
+	sess, err := s.sessions.Get(r.Context(), cookie.Value)
+	if err == nil && !sess.Pending {
+		err = session.ErrNotFound
+	}
+	return cookie.Value, sess, err
+}
+
+func (s *Server) HandleSecondFactorPage(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := s.pendingSession(r); err != nil {
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "login_2fa.html", nil); err != nil {
+		slog.Error("Failed to render two-factor login template", "error", err)
+	}
+}
+
+func (s *Server) HandleSecondFactor(w http.ResponseWriter, r *http.Request) {
+	token, pending, err := s.pendingSession(r)
+	if errors.Is(err, session.ErrNotFound) {
+		s.renderLogin(w, "Your sign-in expired, please enter your password again")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load session", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	if wait, locked := s.loginWait(r, pending.Username); wait > 0 {
+		s.renderLoginThrottled(w, "login_2fa.html", "", wait, locked)
+		return
+	}
+
+	valid, err := s.checkSecondFactor(r.Context(), pending.Username, r.FormValue("code"))
+	if err != nil {
+		slog.Error("Failed to verify two-factor code", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		s.loginFailed(r, pending.Username, models.LoginFailureCode)
+		pending.Attempts++
+		if pending.Attempts >= secondFactorAttempts {
+			s.deleteSession(r.Context(), token)
+			s.renderLogin(w, "Too many incorrect codes, please enter your password again")
+			return
+		}
+		if err := s.sessions.Update(r.Context(), token, pending); err != nil {
+			slog.Error("Failed to update session", "error", err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := s.tmplFunc(w, "login_2fa.html", map[string]string{"Error": "Invalid code"}); err != nil {
+			slog.Error("Failed to render two-factor login template", "error", err)
+		}
+		return
+	}
+
+	s.loginSucceeded(r, pending.Username)
+	s.deleteSession(r.Context(), token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_2fa",
+		Value:    "",
+		Path:     "/admin/login",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	s.startSession(w, r, pending.Username)
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "login.html", map[string]string{"Error": msg}); err != nil {
+		slog.Error("Failed to render login template", "error", err)
+	}
+}
+
+// checkSecondFactor accepts either a current authenticator code or one of
+// the user's unused recovery codes, which is then spent.
+func (s *Server) checkSecondFactor(ctx context.Context, username, code string) (bool, error) {
+	secret, err := s.db.GetTOTPSecret(ctx, username)
+	if err != nil || secret == "" {
+		return false, err
+	}
+
+	if step, ok := totp.Verify(secret, code, time.Now()); ok {
+		return s.db.UseTOTPStep(ctx, username, step)
+	}
+	return s.db.UseRecoveryCode(ctx, username, totp.HashRecoveryCode(code))
+}
+
+func (s *Server) HandleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	data := models.TwoFactorPageData{
+		User:      user,
+		CSRFToken: currentSession(r).CSRFToken,
+		Message:   r.URL.Query().Get("message"),
+		Error:     r.URL.Query().Get("error"),
+	}
+
+	if user.TwoFactor {
+		left, err := s.db.CountRecoveryCodes(r.Context(), user.Username)
+		if err != nil {
+			slog.Error("Failed to count recovery codes", "error", err)
+			s.renderError(w, http.StatusInternalServerError)
+			return
+		}
+		data.RecoveryLeft = left
+		s.renderTwoFactor(w, data)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		slog.Error("Failed to generate TOTP secret", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+	s.renderEnrollment(w, data, secret)
+}
+
+// renderEnrollment shows secret as a QR code. The secret round-trips through
+// the form rather than server memory, so enrolling works on any replica; it
+// only takes effect once a code generated from it is entered.
+func (s *Server) renderEnrollment(w http.ResponseWriter, data models.TwoFactorPageData, secret string) {
+	png, err := totp.QRCode(totp.URI(totpIssuer, data.User.Username, secret))
+	if err != nil {
+		slog.Error("Failed to render QR code", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	data.Secret = secret
+	data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	s.renderTwoFactor(w, data)
+}
+
+func (s *Server) renderTwoFactor(w http.ResponseWriter, data models.TwoFactorPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "two_factor.html", data); err != nil {
+		slog.Error("Failed to render two-factor template", "error", err)
+	}
+}
+
+func (s *Server) HandleEnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user.TwoFactor {
+		http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+		return
+	}
+
+	secret := r.FormValue("secret")
+	if _, err := totp.Code(secret, 0); secret == "" || err != nil {
+		http.Redirect(w, r, "/admin/2fa?error=Setup+expired,+please+scan+the+new+code", http.StatusSeeOther)
+		return
+	}
+
+	step, ok := totp.Verify(secret, r.FormValue("code"), time.Now())
+	if !ok {
+		// Keep the same secret so the app that already scanned it still works
+		s.renderEnrollment(w, models.TwoFactorPageData{
+			User:      user,
+			CSRFToken: currentSession(r).CSRFToken,
+			Error:     "That code didn't match, check your phone's clock and try again",
+		}, secret)
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		slog.Error("Failed to generate recovery codes", "error", err)
+		http.Redirect(w, r, "/admin/2fa?error=Failed+to+enable+two-factor+authentication", http.StatusSeeOther)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = totp.HashRecoveryCode(c)
+	}
+
+	if err := s.db.EnableTOTP(r.Context(), user.Username, secret, step, hashes); err != nil {
+		slog.Error("Failed to enable two-factor authentication", "error", err)
+		http.Redirect(w, r, "/admin/2fa?error=Failed+to+enable+two-factor+authentication", http.StatusSeeOther)
+		return
+	}
+
+	user.TwoFactor = true
+	s.renderTwoFactor(w, models.TwoFactorPageData{
+		User:          user,
+		CSRFToken:     currentSession(r).CSRFToken,
+		RecoveryCodes: codes,
+		RecoveryLeft:  len(codes),
+		Message:       "Two-factor authentication is on",
+	})
+}
+
+func (s *Server) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username := currentUser(r).Username
+
+	valid, err := s.checkSecondFactor(r.Context(), username, r.FormValue("code"))
+	if err != nil {
+		slog.Error("Failed to verify two-factor code", "error", err)
+		http.Redirect(w, r, "/admin/2fa?error=Failed+to+disable+two-factor+authentication", http.StatusSeeOther)
+		return
+	}
+	if !valid {
+		http.Redirect(w, r, "/admin/2fa?error=Invalid+code", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.db.DisableTOTP(r.Context(), username); err != nil {
+		slog.Error("Failed to disable two-factor authentication", "error", err)
+		http.Redirect(w, r, "/admin/2fa?error=Failed+to+disable+two-factor+authentication", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/2fa?message=Two-factor+authentication+is+off", http.StatusSeeOther)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/alexraskin/standwithiran/internal/database"
+	"github.com/alexraskin/standwithiran/internal/models"
+)
+
+func (s *Server) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.db.GetUsers(r.Context())
+	if err != nil {
+		slog.Error("Failed to load users", "error", err)
+		s.renderError(w, http.StatusInternalServerError)
+		return
+	}
+
+	data := models.UsersPageData{
+		Users:     users,
+		Roles:     models.Roles,
+		User:      currentUser(r),
+		CSRFToken: currentSession(r).CSRFToken,
+		Message:   r.URL.Query().Get("message"),
+		Error:     r.URL.Query().Get("error"),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmplFunc(w, "users.html", data); err != nil {
+		slog.Error("Failed to render users template", "error", err)
+	}
+}
+
+func (s *Server) HandleAddUser(w http.ResponseWriter, r *http.Request) {
+	user := models.User{
+		Username: strings.ToLower(strings.TrimSpace(r.FormValue("username"))),
+		Role:     r.FormValue("role"),
+	}
+	password := r.FormValue("password")
+
+	if !models.ValidUsername(user.Username) {
+		http.Redirect(w, r, "/admin/users?error=Usernames+are+2-32+lowercase+letters,+digits,+dots,+dashes+or+underscores", http.StatusSeeOther)
+		return
+	}
+	if !slices.Contains(models.Roles, user.Role) {
+		http.Redirect(w, r, "/admin/users?error=Invalid+role", http.StatusSeeOther)
+		return
+	}
+	if len(password) < MinPasswordLength {
+		http.Redirect(w, r, "/admin/users?error="+passwordTooShort, http.StatusSeeOther)
+		return
+	}
+
+	if err := s.db.AddUser(r.Context(), user, password); err != nil {
+		if errors.Is(err, database.ErrUserExists) {
+			http.Redirect(w, r, "/admin/users?error=That+username+is+taken", http.StatusSeeOther)
+			return
+		}
+		slog.Error("Failed to add user", "error", err)
+		http.Redirect(w, r, "/admin/users?error=Failed+to+add+user", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/users?message=User+added", http.StatusSeeOther)
+}
+
+func (s *Server) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+	role := r.FormValue("role")
+
+	if !slices.Contains(models.Roles, role) {
+		http.Redirect(w, r, "/admin/users?error=Invalid+role", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.db.SetUserRole(r.Context(), username, role); err != nil {
+		s.redirectUserError(w, r, "Failed to update user role", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/users?message=Role+updated", http.StatusSeeOther)
+}
+
+func (s *Server) HandleResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+
+	if len(password) < MinPasswordLength {
+		http.Redirect(w, r, "/admin/users?error="+passwordTooShort, http.StatusSeeOther)
+		return
+	}
+
+	if err := s.db.SetUserPassword(r.Context(), username, password); err != nil {
+		s.redirectUserError(w, r, "Failed to reset password", err)
+		return
+	}
+	s.revokeOtherSessions(r, username)
+
+	http.Redirect(w, r, "/admin/users?message=Password+reset", http.StatusSeeOther)
+}
+
+// HandleResetUserTwoFactor turns off two-factor authentication for a user
+// who has lost both their phone and their recovery codes. Their sessions
+// are revoked, since whoever holds the lost phone may hold one of them too.
+func (s *Server) HandleResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+
+	if err := s.db.DisableTOTP(r.Context(), username); err != nil {
+		s.redirectUserError(w, r, "Failed to reset two-factor authentication", err)
+		return
+	}
+	s.revokeOtherSessions(r, username)
+
+	http.Redirect(w, r, "/admin/users?message=Two-factor+authentication+reset", http.StatusSeeOther)
+}
+
+func (s *Server) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+
+	if username == currentUser(r).Username {
+		http.Redirect(w, r, "/admin/users?error=You+can't+delete+your+own+account", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.db.DeleteUser(r.Context(), username); err != nil {
+		s.redirectUserError(w, r, "Failed to delete user", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/users?message=User+deleted", http.StatusSeeOther)
+}
+
+// redirectUserError reports a failed change to an existing account.
+func (s *Server) redirectUserError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		http.Redirect(w, r, "/admin/users?error=User+not+found", http.StatusSeeOther)
+	case errors.Is(err, database.ErrLastOwner):
+		http.Redirect(w, r, "/admin/users?error=There+must+be+at+least+one+owner", http.StatusSeeOther)
+	default:
+		slog.Error(msg, "error", err)
+		http.Redirect(w, r, "/admin/users?error="+strings.ReplaceAll(msg, " ", "+"), http.StatusSeeOther)
+	}
+}
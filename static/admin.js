@@ -0,0 +1,61 @@
+const linkList = document.getElementById('link-list');
+const reorderForm = document.getElementById('reorder-form');
+let draggedItem = null;
+let savedOrder = currentOrder();
+
+if (linkList && reorderForm) {
+    linkList.addEventListener('dragstart', (e) => {
+        draggedItem = e.target.closest('.link-list-item');
+        if (draggedItem) {
+            draggedItem.classList.add('dragging');
+            e.dataTransfer.effectAllowed = 'move';
+        }
+    });
+
+    linkList.addEventListener('dragover', (e) => {
+        if (!draggedItem) return;
+        e.preventDefault();
+        const target = e.target.closest('.link-list-item');
+        if (!target || target === draggedItem) return;
+        const rect = target.getBoundingClientRect();
+        const after = e.clientY > rect.top + rect.height / 2;
+        linkList.insertBefore(draggedItem, after ? target.nextSibling : target);
+    });
+
+    linkList.addEventListener('dragend', () => {
+        if (!draggedItem) return;
+        draggedItem.classList.remove('dragging');
+        draggedItem = null;
+        saveOrder();
+    });
+}
+
+function currentOrder() {
+    if (!linkList) return [];
+    return Array.from(linkList.querySelectorAll('.link-list-item'), (item) => item.dataset.id);
+}
+
+function saveOrder() {
+    const order = currentOrder();
+    if (order.join() === savedOrder.join()) return;
+    savedOrder = order;
+
+    reorderForm.querySelectorAll('input[name="id"]').forEach((input) => input.remove());
+    order.forEach((id) => {
+        const input = document.createElement('input');
+        input.type = 'hidden';
+        input.name = 'id';
+        input.value = id;
+        reorderForm.appendChild(input);
+    });
+    reorderForm.submit();
+}
+
+// Buttons with data-confirm ask before submitting. The CSP blocks inline
+// onclick handlers, so this is wired up here.
+document.addEventListener('click', (e) => {
+    const button = e.target.closest('[data-confirm]');
+    if (button && !confirm(button.dataset.confirm)) {
+        e.preventDefault();
+    }
+});
@@ -26,3 +26,17 @@ function copyLink() {
     });
 }
 
+const shareActions = {
+    twitter: shareTwitter,
+    facebook: shareFacebook,
+    whatsapp: shareWhatsApp,
+    telegram: shareTelegram,
+    copy: copyLink,
+};
+
+document.querySelectorAll('[data-share]').forEach((el) => {
+    el.addEventListener('click', (e) => {
+        e.preventDefault();
+        shareActions[el.dataset.share]();
+    });
+});